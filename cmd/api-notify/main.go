@@ -8,13 +8,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"api-notify/internal/config"
 	"api-notify/internal/dispatcher"
 	"api-notify/internal/httpapi"
+	"api-notify/internal/leader"
 	"api-notify/internal/metrics"
+	"api-notify/internal/secrets"
+	"api-notify/internal/security"
+	"api-notify/internal/signing"
 	"api-notify/internal/store"
 	"api-notify/pkg/httpclient"
 	"api-notify/pkg/logging"
@@ -53,20 +58,60 @@ func main() {
 		return
 	}
 
+	// 构建出站目标策略
+	policy, err := security.NewPolicy(cfg)
+	if err != nil {
+		logger.Error("Invalid target policy: %v", err)
+		log.Fatalf("Invalid target policy: %v", err)
+	}
+
 	// 4. 初始化HTTP客户端
-	httpClient := httpclient.New(logger)
+	clientCfg, err := httpClientConfig(cfg, policy)
+	if err != nil {
+		logger.Error("Invalid HTTP client configuration: %v", err)
+		log.Fatalf("Invalid HTTP client configuration: %v", err)
+	}
+	httpClient, err := httpclient.NewWithConfig(logger, clientCfg)
+	if err != nil {
+		logger.Error("Failed to initialize HTTP client: %v", err)
+		log.Fatalf("Failed to initialize HTTP client: %v", err)
+	}
 	logger.Info("HTTP client initialized successfully")
 
 	// 5. 初始化指标收集器
 	metricsCollector := metrics.NewSimpleMetrics(logger)
 	logger.Info("Metrics collector initialized successfully")
 
+	// 加载Ed25519签名密钥
+	keyring, err := loadEd25519Keyring(cfg)
+	if err != nil {
+		logger.Error("Failed to load ed25519 signing keys: %v", err)
+		log.Fatalf("Failed to load ed25519 signing keys: %v", err)
+	}
+
+	// 初始化合作方密钥库
+	partnerSecrets, err := loadPartnerSecrets(cfg, store)
+	if err != nil {
+		logger.Error("Failed to initialize partner secrets: %v", err)
+		log.Fatalf("Failed to initialize partner secrets: %v", err)
+	}
+	if cfg.Security.SecretsMasterKey == "" {
+		logger.Warn("SECRETS_MASTER_KEY is not set, partner secrets cannot be stored")
+	}
+
+	// 按配置组装占位符密钥来源
+	secretResolver, secretFiles, err := loadSecretResolver(cfg, partnerSecrets, logger)
+	if err != nil {
+		logger.Error("Invalid secret provider configuration: %v", err)
+		log.Fatalf("Invalid secret provider configuration: %v", err)
+	}
+
 	// 6. 创建HTTP路由
-	router := httpapi.NewRouter(store, logger, cfg)
+	router := httpapi.NewRouter(store, logger, cfg, keyring, policy, partnerSecrets)
 	logger.Info("HTTP router initialized successfully")
 
 	// 7. 创建Worker
-	worker := dispatcher.NewWorker(logger, store, httpClient, cfg)
+	worker := dispatcher.NewWorker(logger, store, httpClient, cfg, metricsCollector, keyring, policy, secretResolver)
 
 	// 8. 创建HTTP服务器
 	server := &http.Server{
@@ -88,8 +133,16 @@ func main() {
 				return
 			case <-ticker.C:
 				stats := metricsCollector.GetStats()
-				logger.Info("Metrics: InboundRequests=%d, NotificationsSent=%d, SuccessCount=%d, FailureCount=%d, AverageLatency=%v, AverageRetries=%.2f, DeadTasks=%d",
-					stats.InboundRequests, stats.NotificationsSent, stats.SuccessCount, stats.FailureCount, stats.AverageLatency, stats.AverageRetries, stats.DeadTasks)
+				logger.Info("Metrics: InboundRequests=%d, NotificationsSent=%d, SuccessCount=%d, FailureCount=%d, AverageLatency=%v, AverageRetries=%.2f, DeadTasks=%d, ConcurrencyLimits=%v",
+					stats.InboundRequests, stats.NotificationsSent, stats.SuccessCount, stats.FailureCount, stats.AverageLatency, stats.AverageRetries, stats.DeadTasks, stats.ConcurrencyLimits)
+				logger.Info("Connection timing: AvgDNS=%v, AvgConnect=%v, AvgTLS=%v, AvgTTFB=%v, AvgTransfer=%v, ConnReuseRate=%.2f",
+					stats.AverageTiming.DNS, stats.AverageTiming.Connect, stats.AverageTiming.TLSHandshake,
+					stats.AverageTiming.TimeToFirstByte, stats.AverageTiming.Transfer, stats.ConnReuseRate)
+				for partnerID, timing := range stats.PartnerTimings {
+					logger.Debug("Connection timing for partner %s: AvgDNS=%v, AvgConnect=%v, AvgTLS=%v, AvgTTFB=%v, AvgTransfer=%v, ConnReuseRate=%.2f",
+						partnerID, timing.AverageTiming.DNS, timing.AverageTiming.Connect, timing.AverageTiming.TLSHandshake,
+						timing.AverageTiming.TimeToFirstByte, timing.AverageTiming.Transfer, timing.ConnReuseRate)
+				}
 			}
 		}
 	}()
@@ -97,6 +150,65 @@ func main() {
 	// 9. 启动Worker
 	worker.Start(ctx)
 
+	// 监听合作方证书文件变化
+	go httpClient.WatchProfiles(ctx, cfg.HTTPClient.CertReloadInterval)
+
+	// 监听密钥目录变化，变化后清除密钥缓存
+	if secretFiles != nil {
+		go secretFiles.Watch(ctx, cfg.Secrets.FileWatchInterval, secretResolver.Purge)
+	}
+
+	// 启动领导者选举，单例后台任务只在领导者实例上运行
+	elector := leader.NewElector(store, logger, "api-notify-singleton", cfg.Leader.InstanceID, cfg.Leader.LeaseTTL, cfg.Leader.RenewInterval)
+	elector.Register("stale-task-reaper", leader.Every(cfg.Worker.ReapInterval, func(ctx context.Context) {
+		reaped, err := store.ReapStaleTasks(ctx, cfg.Worker.StaleTaskTimeout)
+		if err != nil {
+			logger.Error("Failed to reap stale tasks: %v", err)
+			return
+		}
+		if reaped > 0 {
+			logger.Info("Reaped %d stale running tasks", reaped)
+		}
+	}))
+	// 超过过期时间仍未投递成功的任务改为expired并发送状态回调
+	elector.Register("task-expirer", leader.Every(cfg.Worker.ReapInterval, worker.ExpireTasks))
+	// 启用静态加密时，将明文行和旧密钥包装的行改用当前密钥
+	if len(cfg.Database.Encryption.Keys) > 0 {
+		elector.Register("payload-reencrypt", leader.Every(cfg.Database.Encryption.ReencryptInterval, func(ctx context.Context) {
+			reencrypted, err := store.ReencryptTasks(ctx, cfg.Database.Encryption.ReencryptBatchSize)
+			if err != nil {
+				logger.Error("Failed to re-encrypt task payloads: %v", err)
+			}
+			if reencrypted > 0 {
+				logger.Info("Re-encrypted %d task payloads with the active key", reencrypted)
+			}
+			reencrypted, err = store.ReencryptSigningSecrets(ctx)
+			if err != nil {
+				logger.Error("Failed to re-encrypt signing secrets: %v", err)
+			}
+			if reencrypted > 0 {
+				logger.Info("Re-encrypted %d signing secrets with the active key", reencrypted)
+			}
+		}))
+	}
+	// 启用blob存储时，删除已无任务引用的blob（任务插入失败、重新加密后替换下来的对象）
+	if cfg.Blob.Backend != "" && cfg.Blob.GCInterval > 0 {
+		elector.Register("blob-gc", leader.Every(cfg.Blob.GCInterval, func(ctx context.Context) {
+			deleted, err := store.CollectOrphanBlobs(ctx, 500)
+			if err != nil {
+				logger.Error("Failed to collect orphan blobs: %v", err)
+			}
+			if deleted > 0 {
+				logger.Info("Deleted %d unreferenced blobs", deleted)
+			}
+		}))
+	}
+	electorDone := make(chan struct{})
+	go func() {
+		defer close(electorDone)
+		elector.Run(ctx)
+	}()
+
 	// 10. 启动HTTP服务器
 	go func() {
 		logger.Info("HTTP server starting on port %d", cfg.Server.Port)
@@ -113,6 +225,9 @@ func main() {
 	// 12. 停止Worker
 	worker.Stop()
 
+	// 等待单例任务停止并释放租约
+	<-electorDone
+
 	// 13. 关闭HTTP服务器
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -124,4 +239,137 @@ func main() {
 	}
 
 	logger.Info("API notification service stopped successfully")
-}
\ No newline at end of file
+}
+
+// loadEd25519Keyring 从配置加载Ed25519签名密钥环
+func loadEd25519Keyring(cfg *config.Config) (*signing.Ed25519Keyring, error) {
+	keys := make([]signing.Ed25519Key, 0, len(cfg.Signing.Ed25519Keys))
+	for _, keyCfg := range cfg.Signing.Ed25519Keys {
+		key, err := signing.LoadEd25519Key(keyCfg.KeyID, keyCfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return signing.NewEd25519Keyring(keys, cfg.Signing.ActiveEd25519KeyID)
+}
+
+// loadPartnerSecrets 使用主密钥创建合作方密钥库，未配置主密钥时密钥库只读
+func loadPartnerSecrets(cfg *config.Config, st *store.Store) (*secrets.PartnerSecrets, error) {
+	if cfg.Security.SecretsMasterKey == "" {
+		return secrets.NewPartnerSecrets(st, nil), nil
+	}
+
+	key, err := secrets.ParseKey(cfg.Security.SecretsMasterKey)
+	if err != nil {
+		return nil, err
+	}
+	cipher, err := secrets.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return secrets.NewPartnerSecrets(st, cipher), nil
+}
+
+// loadSecretResolver 按配置顺序组装占位符密钥来源，配置文件中的SensitiveHeaders作为最后的来源
+// 启用文件来源时同时返回该来源，用于监听目录变化
+func loadSecretResolver(cfg *config.Config, partnerSecrets *secrets.PartnerSecrets, logger *logging.Logger) (*secrets.Resolver, *secrets.FileProvider, error) {
+	var providers []secrets.Provider
+	var fileProvider *secrets.FileProvider
+	for _, name := range cfg.Secrets.Providers {
+		switch strings.TrimSpace(name) {
+		case "":
+			continue
+		case "db":
+			providers = append(providers, partnerSecrets)
+		case "env":
+			providers = append(providers, secrets.NewEnvProvider(cfg.Secrets.EnvPrefix))
+		case "file":
+			if cfg.Secrets.FileDir == "" {
+				return nil, nil, fmt.Errorf("secret provider file requires SECRET_FILE_DIR")
+			}
+			fileProvider = secrets.NewFileProvider(cfg.Secrets.FileDir, logger)
+			providers = append(providers, fileProvider)
+		case "http":
+			if cfg.Secrets.HTTP.URL == "" {
+				return nil, nil, fmt.Errorf("secret provider http requires SECRET_HTTP_URL")
+			}
+			providers = append(providers, secrets.NewHTTPProvider(cfg.Secrets.HTTP.URL, cfg.Secrets.HTTP.Token, cfg.Secrets.HTTP.Mount, cfg.Secrets.HTTP.Timeout))
+		default:
+			return nil, nil, fmt.Errorf("unknown secret provider %q", name)
+		}
+	}
+	providers = append(providers, secrets.NewStaticProvider(cfg.Security.SensitiveHeaders))
+
+	resolver := secrets.NewResolver(logger, cfg.Secrets.CacheTTL, providers...)
+	// 创建任务时敏感头保存在合作方密钥库，即使来源配置不包含db也要从密钥库读取
+	resolver.SetTaskSecrets(partnerSecrets)
+	// 本实例修改合作方密钥后立即生效，其他实例在缓存过期后生效
+	partnerSecrets.OnChange(resolver.Invalidate)
+	return resolver, fileProvider, nil
+}
+
+// httpClientConfig 根据安全配置和合作方配置构建HTTP客户端配置
+func httpClientConfig(cfg *config.Config, policy *security.Policy) (httpclient.Config, error) {
+	allowCIDRs, err := httpclient.ParseCIDRs(cfg.Security.AllowedCIDRs)
+	if err != nil {
+		return httpclient.Config{}, err
+	}
+	denyCIDRs, err := httpclient.ParseCIDRs(cfg.Security.DeniedCIDRs)
+	if err != nil {
+		return httpclient.Config{}, err
+	}
+
+	clientCfg := httpclient.Config{
+		Profiles: make(map[string]httpclient.Profile),
+		IPPolicy: &httpclient.IPPolicy{
+			DenyPrivate: cfg.Security.BlockPrivateNetworks,
+			AllowCIDRs:  allowCIDRs,
+			DenyCIDRs:   denyCIDRs,
+		},
+		// 重定向目标同样需要符合出站策略，配置档名称即合作方ID
+		AllowRedirect:    policy.Check,
+		MaxResponseBytes: cfg.HTTPClient.MaxResponseBytes,
+		Timeouts: httpclient.Timeouts{
+			Connect:        cfg.HTTPClient.ConnectTimeout,
+			TLSHandshake:   cfg.HTTPClient.TLSHandshakeTimeout,
+			ResponseHeader: cfg.HTTPClient.ResponseHeaderTimeout,
+			Total:          cfg.HTTPClient.TotalTimeout,
+		},
+		Proxy: &httpclient.ProxyConfig{
+			URL:     cfg.HTTPClient.Proxy.URL,
+			NoProxy: cfg.HTTPClient.Proxy.NoProxy,
+		},
+	}
+
+	for partnerID, partner := range cfg.Partners {
+		switch partner.Compression.Algorithm {
+		case "", httpclient.CompressionGzip, httpclient.CompressionDeflate:
+		default:
+			return httpclient.Config{}, fmt.Errorf("partner %s: unsupported compression algorithm %q", partnerID, partner.Compression.Algorithm)
+		}
+
+		// 未配置TLS和代理的合作方共用默认传输层
+		if partner.TLS == nil && partner.Proxy == nil {
+			continue
+		}
+		var profile httpclient.Profile
+		if partner.TLS != nil {
+			profile.TLS = &httpclient.TLSProfile{
+				CertFile:   partner.TLS.CertFile,
+				KeyFile:    partner.TLS.KeyFile,
+				CAFile:     partner.TLS.CAFile,
+				MinVersion: partner.TLS.MinVersion,
+				ServerName: partner.TLS.ServerName,
+			}
+		}
+		if partner.Proxy != nil {
+			profile.Proxy = &httpclient.ProxyConfig{
+				URL:     partner.Proxy.URL,
+				NoProxy: partner.Proxy.NoProxy,
+			}
+		}
+		clientCfg.Profiles[partnerID] = profile
+	}
+	return clientCfg, nil
+}
@@ -0,0 +1,99 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotFound blob不存在
+var ErrNotFound = errors.New("blob not found")
+
+// refPrefix 内容引用前缀，引用格式为 sha256:<64位十六进制摘要>
+const refPrefix = "sha256:"
+
+// Backend blob存储后端，按键读写对象
+// 键由ContentStore根据内容生成，同一个键的内容始终相同，重复写入是幂等的
+type Backend interface {
+	// Name 后端名称，用于日志
+	Name() string
+	// Put 写入对象
+	Put(ctx context.Context, key string, data []byte) error
+	// Get 读取对象，不存在时返回ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(ctx context.Context, key string) error
+}
+
+// ContentStore 内容寻址存储：以内容的SHA-256摘要作为键，读取时校验摘要
+type ContentStore struct {
+	backend Backend
+}
+
+// NewContentStore 基于存储后端创建内容寻址存储
+func NewContentStore(backend Backend) *ContentStore {
+	return &ContentStore{backend: backend}
+}
+
+// Ref 返回内容对应的引用，不保存内容
+func (s *ContentStore) Ref(data []byte) string {
+	return refPrefix + digest(data)
+}
+
+// Put 保存内容并返回引用，相同内容得到相同引用
+func (s *ContentStore) Put(ctx context.Context, data []byte) (string, error) {
+	key := digest(data)
+	if err := s.backend.Put(ctx, key, data); err != nil {
+		return "", fmt.Errorf("failed to put blob to %s: %w", s.backend.Name(), err)
+	}
+	return refPrefix + key, nil
+}
+
+// Get 按引用读取内容，内容与引用中的摘要不一致时返回错误
+func (s *ContentStore) Get(ctx context.Context, ref string) ([]byte, error) {
+	key, err := parseRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.backend.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob %s from %s: %w", ref, s.backend.Name(), err)
+	}
+	if digest(data) != key {
+		return nil, fmt.Errorf("blob %s from %s is corrupted: digest mismatch", ref, s.backend.Name())
+	}
+	return data, nil
+}
+
+// Delete 按引用删除内容，调用方需确认没有其他地方引用该内容（相同内容共用一个对象）
+func (s *ContentStore) Delete(ctx context.Context, ref string) error {
+	key, err := parseRef(ref)
+	if err != nil {
+		return err
+	}
+	if err := s.backend.Delete(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete blob %s from %s: %w", ref, s.backend.Name(), err)
+	}
+	return nil
+}
+
+// digest 计算内容的SHA-256十六进制摘要
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// parseRef 解析内容引用，返回摘要
+func parseRef(ref string) (string, error) {
+	key, ok := strings.CutPrefix(ref, refPrefix)
+	if !ok || len(key) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid blob reference %q", ref)
+	}
+	if _, err := hex.DecodeString(key); err != nil {
+		return "", fmt.Errorf("invalid blob reference %q", ref)
+	}
+	return key, nil
+}
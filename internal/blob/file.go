@@ -0,0 +1,84 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// FileBackend 本地文件系统后端，对象路径为 目录/键前两位/键
+// 多实例部署时目录需为共享存储（如NFS）
+type FileBackend struct {
+	dir string
+}
+
+// NewFileBackend 创建本地文件系统后端
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create blob dir: %w", err)
+	}
+	return &FileBackend{dir: dir}, nil
+}
+
+// Name 后端名称
+func (b *FileBackend) Name() string { return "file" }
+
+// path 返回对象的文件路径
+func (b *FileBackend) path(key string) string {
+	return filepath.Join(b.dir, key[:2], key)
+}
+
+// Put 写入对象，先写临时文件再重命名，读取方不会看到写了一半的文件；对象已存在时跳过
+func (b *FileBackend) Put(ctx context.Context, key string, data []byte) error {
+	path := b.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create blob dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create blob file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write blob file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync blob file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close blob file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename blob file: %w", err)
+	}
+	return nil
+}
+
+// Get 读取对象
+func (b *FileBackend) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(b.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob file: %w", err)
+	}
+	return data, nil
+}
+
+// Delete 删除对象
+func (b *FileBackend) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(b.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob file: %w", err)
+	}
+	return nil
+}
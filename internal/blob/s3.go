@@ -0,0 +1,204 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config S3兼容对象存储配置
+type S3Config struct {
+	// Endpoint 服务地址，如 https://s3.us-east-1.amazonaws.com 或本地的 http://127.0.0.1:9000
+	Endpoint string
+	Bucket   string
+	Region   string
+	// AccessKeyID和SecretAccessKey为空时不签名（用于无需认证的本地替身服务）
+	AccessKeyID     string
+	SecretAccessKey string
+	// Prefix 对象键前缀
+	Prefix string
+	// Timeout 单次请求超时
+	Timeout time.Duration
+	// MaxObjectBytes 读取对象的最大字节数
+	MaxObjectBytes int64
+}
+
+// S3Backend S3兼容对象存储后端，使用路径风格地址（{Endpoint}/{Bucket}/{Prefix}{键}）和AWS Signature V4签名
+// 兼容AWS S3、MinIO等实现，也可以指向本地的替身服务
+type S3Backend struct {
+	cfg    S3Config
+	client *http.Client
+}
+
+// NewS3Backend 创建S3兼容对象存储后端
+func NewS3Backend(cfg S3Config) (*S3Backend, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint must be an http or https url")
+	}
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 bucket is required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.MaxObjectBytes <= 0 {
+		cfg.MaxObjectBytes = 64 << 20
+	}
+	cfg.Endpoint = strings.TrimRight(cfg.Endpoint, "/")
+	return &S3Backend{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout}}, nil
+}
+
+// Name 后端名称
+func (b *S3Backend) Name() string { return "s3" }
+
+// Put 写入对象
+func (b *S3Backend) Put(ctx context.Context, key string, data []byte) error {
+	req, err := b.newRequest(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Type", "application/octet-stream")
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to put object: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("object storage returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Get 读取对象
+func (b *S3Backend) Get(ctx context.Context, key string) ([]byte, error) {
+	req, err := b.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("object storage returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, b.cfg.MaxObjectBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	if int64(len(data)) > b.cfg.MaxObjectBytes {
+		return nil, fmt.Errorf("object exceeds %d bytes", b.cfg.MaxObjectBytes)
+	}
+	return data, nil
+}
+
+// Delete 删除对象，对象不存在（404）时同样视为成功
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	req, err := b.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to delete object: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("object storage returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newRequest 创建对象请求并签名
+func (b *S3Backend) newRequest(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	path := "/" + uriEncode(b.cfg.Bucket, false) + "/" + uriEncode(b.cfg.Prefix+key, true)
+	req, err := http.NewRequestWithContext(ctx, method, b.cfg.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create object request: %w", err)
+	}
+	if b.cfg.AccessKeyID != "" {
+		b.sign(req, path, body, time.Now().UTC())
+	}
+	return req, nil
+}
+
+// sign 按AWS Signature V4为请求签名（只签名host、x-amz-content-sha256和x-amz-date头）
+func (b *S3Backend) sign(req *http.Request, canonicalURI string, body []byte, now time.Time) {
+	payloadHash := digest(body)
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + b.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + digest([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+b.cfg.SecretAccessKey), date)
+	for _, part := range []string{b.cfg.Region, "s3", "aws4_request"} {
+		signingKey = hmacSHA256(signingKey, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// uriEncode 按S3规则编码路径，只保留非保留字符，keepSlash为true时保留/
+func uriEncode(s string, keepSlash bool) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			buf.WriteByte(c)
+		case c == '/' && keepSlash:
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+// hmacSHA256 计算HMAC-SHA256
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
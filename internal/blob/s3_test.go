@@ -0,0 +1,218 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKeyID     = "AKIDEXAMPLE"
+	testSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion          = "eu-test-1"
+)
+
+// s3StandIn 测试用的S3替身服务：路径风格地址，校验SigV4签名，对象保存在内存中
+type s3StandIn struct {
+	server *httptest.Server
+	t      *testing.T
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	paths   []string
+}
+
+// newS3StandIn 启动S3替身服务
+func newS3StandIn(t *testing.T) *s3StandIn {
+	t.Helper()
+	s := &s3StandIn{t: t, objects: make(map[string][]byte)}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// handle 校验签名后处理PUT/GET/DELETE
+func (s *s3StandIn) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if err := verifySigV4(r, body); err != nil {
+		s.t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = append(s.paths, r.URL.Path)
+
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[r.URL.Path] = body
+	case http.MethodGet:
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// verifySigV4 按服务端收到的请求重新计算AWS Signature V4签名并与Authorization头比较
+func verifySigV4(r *http.Request, body []byte) error {
+	payloadHash := sha256Hex(body)
+	if got := r.Header.Get("X-Amz-Content-Sha256"); got != payloadHash {
+		return errors.New("x-amz-content-sha256 does not match the body: " + got)
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if _, err := time.Parse("20060102T150405Z", amzDate); err != nil {
+		return errors.New("invalid x-amz-date: " + amzDate)
+	}
+
+	date := amzDate[:8]
+	scope := date + "/" + testRegion + "/s3/aws4_request"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		"host:" + r.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + testSecretAccessKey)
+	for _, part := range []string{date, testRegion, "s3", "aws4_request"} {
+		key = hmacSum(key, part)
+	}
+	signature := hex.EncodeToString(hmacSum(key, stringToSign))
+
+	want := "AWS4-HMAC-SHA256 Credential=" + testAccessKeyID + "/" + scope +
+		", SignedHeaders=" + signedHeaders + ", Signature=" + signature
+	if got := r.Header.Get("Authorization"); got != want {
+		return errors.New("signature mismatch: " + got)
+	}
+	return nil
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// newTestS3Backend 创建连接到替身服务的S3后端
+func newTestS3Backend(t *testing.T, s *s3StandIn) *S3Backend {
+	t.Helper()
+	backend, err := NewS3Backend(S3Config{
+		Endpoint:        s.server.URL + "/",
+		Bucket:          "notify-bodies",
+		Region:          testRegion,
+		AccessKeyID:     testAccessKeyID,
+		SecretAccessKey: testSecretAccessKey,
+		Prefix:          "tasks/",
+		Timeout:         5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
+
+func TestS3BackendSignedPathStyleRequests(t *testing.T) {
+	standIn := newS3StandIn(t)
+	backend := newTestS3Backend(t, standIn)
+	ctx := context.Background()
+
+	if err := backend.Put(ctx, "key with space", []byte("hello")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	data, err := backend.Get(ctx, "key with space")
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("Get() = %q, %v; want hello", data, err)
+	}
+
+	standIn.mu.Lock()
+	paths := append([]string(nil), standIn.paths...)
+	standIn.mu.Unlock()
+	for _, path := range paths {
+		if path != "/notify-bodies/tasks/key with space" {
+			t.Fatalf("request path = %q, want path-style /notify-bodies/tasks/key with space", path)
+		}
+	}
+}
+
+func TestS3BackendNotFound(t *testing.T) {
+	backend := newTestS3Backend(t, newS3StandIn(t))
+
+	if _, err := backend.Get(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestS3ContentStoreRoundTrip(t *testing.T) {
+	standIn := newS3StandIn(t)
+	store := NewContentStore(newTestS3Backend(t, standIn))
+	ctx := context.Background()
+	body := []byte(`{"event":"order.paid","amount":42}`)
+
+	ref, err := store.Put(ctx, body)
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if ref != "sha256:"+sha256Hex(body) {
+		t.Fatalf("ref = %q, want sha256 of the body", ref)
+	}
+	data, err := store.Get(ctx, ref)
+	if err != nil || string(data) != string(body) {
+		t.Fatalf("Get() = %q, %v; want the stored body", data, err)
+	}
+
+	// 对象内容被改动时摘要校验失败
+	standIn.mu.Lock()
+	standIn.objects["/notify-bodies/tasks/"+sha256Hex(body)] = []byte(`{"event":"order.paid","amount":4200}`)
+	standIn.mu.Unlock()
+	if _, err := store.Get(ctx, ref); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Fatalf("Get() of a tampered object error = %v, want digest mismatch", err)
+	}
+
+	// 引用对应的对象不存在
+	missing := "sha256:" + sha256Hex([]byte("never stored"))
+	if _, err := store.Get(ctx, missing); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() of a missing ref error = %v, want ErrNotFound", err)
+	}
+
+	// 删除后读取返回ErrNotFound，重复删除不报错
+	if err := store.Delete(ctx, ref); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, ref); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get() after Delete() error = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, ref); err != nil {
+		t.Fatalf("second Delete() error = %v", err)
+	}
+}
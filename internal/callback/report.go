@@ -0,0 +1,106 @@
+package callback
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"api-notify/internal/core"
+	"api-notify/internal/store"
+)
+
+// EventType 状态回调任务的事件类型
+const EventType = "notification.status"
+
+// idempotencyPrefix 回调任务幂等键前缀，保证每个任务最多产生一个回调
+const idempotencyPrefix = "callback:"
+
+// StatusReport 状态回调的请求体
+type StatusReport struct {
+	Type         string          `json:"type"`
+	TaskID       string          `json:"task_id"`
+	PartnerID    string          `json:"partner_id"`
+	EventType    string          `json:"event_type,omitempty"`
+	Status       core.TaskStatus `json:"status"`
+	AttemptCount int             `json:"attempt_count"`
+	LastError    *LastError      `json:"last_error,omitempty"`
+	FinishedAt   string          `json:"finished_at"`
+}
+
+// LastError 最后一次失败尝试的错误信息
+type LastError struct {
+	Code           string `json:"code,omitempty"`
+	Message        string `json:"message,omitempty"`
+	HTTPStatusCode int    `json:"http_status_code,omitempty"`
+}
+
+// Enqueue 为到达终态的任务创建状态回调任务，回调任务与普通通知一样由派发器投递和重试
+// 任务未设置callback_url时不创建；回调任务本身不设置callback_url，不会产生新的回调
+func Enqueue(ctx context.Context, st *store.Store, task *core.NotificationTask, status core.TaskStatus, maxAttempts int) error {
+	if task.CallbackURL == "" {
+		return nil
+	}
+
+	idempotencyKey := idempotencyPrefix + task.TaskID
+	existing, err := st.GetTaskByIdempotencyKey(ctx, idempotencyKey, task.PartnerID)
+	if err != nil {
+		return fmt.Errorf("failed to check callback task: %w", err)
+	}
+	if existing != nil {
+		return nil
+	}
+
+	attempts, err := st.GetAttemptsByTaskID(ctx, task.TaskID)
+	if err != nil {
+		return fmt.Errorf("failed to get attempts for callback: %w", err)
+	}
+
+	report := StatusReport{
+		Type:         EventType,
+		TaskID:       task.TaskID,
+		PartnerID:    task.PartnerID,
+		EventType:    task.EventType,
+		Status:       status,
+		AttemptCount: len(attempts),
+		FinishedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	if status != core.TaskStatusSucceeded && len(attempts) > 0 {
+		last := attempts[len(attempts)-1]
+		report.LastError = &LastError{
+			Code:           last.ErrorCode,
+			Message:        last.ErrorMessage,
+			HTTPStatusCode: last.HTTPStatusCode,
+		}
+	}
+
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode status report: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to generate callback task id: %w", err)
+	}
+
+	callbackTask := &core.NotificationTask{
+		TaskID:         fmt.Sprintf("task_%d_%s", time.Now().UnixNano(), hex.EncodeToString(suffix)),
+		PartnerID:      task.PartnerID,
+		TargetURL:      task.CallbackURL,
+		HTTPMethod:     "POST",
+		Body:           string(body),
+		IdempotencyKey: idempotencyKey,
+		Status:         core.TaskStatusPending,
+		NextAttemptAt:  time.Now(),
+		MaxAttempts:    maxAttempts,
+		EventType:      EventType,
+	}
+	if err := st.CreateTask(ctx, callbackTask); err != nil {
+		return fmt.Errorf("failed to create callback task: %w", err)
+	}
+
+	return nil
+}
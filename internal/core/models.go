@@ -20,6 +20,8 @@ const (
 	TaskStatusCancelled TaskStatus = "cancelled"
 	// TaskStatusDead 任务死亡（超过最大重试次数）
 	TaskStatusDead TaskStatus = "dead"
+	// TaskStatusExpired 已过期（超过expires_at仍未投递成功）
+	TaskStatusExpired TaskStatus = "expired"
 )
 
 // AttemptStatus 通知尝试状态
@@ -46,6 +48,17 @@ type NotificationAttempt struct {
 	ErrorCode     string        `json:"error_code"` // 错误代码
 	ErrorMessage  string        `json:"error_message"` // 错误信息
 	LatencyMs     int64         `json:"latency_ms"` // 延迟时间（毫秒）
+	RedirectChain string        `json:"redirect_chain"` // JSON 格式的重定向链
+	ResponseBody  string        `json:"response_body"` // 截断并脱敏后的响应体
+	ResponseHeaders string      `json:"response_headers"` // JSON 格式的选定响应头
+	DNSMs         int64         `json:"dns_ms"` // DNS解析耗时
+	ConnectMs     int64         `json:"connect_ms"` // 建立TCP连接耗时
+	TLSHandshakeMs int64        `json:"tls_handshake_ms"` // TLS握手耗时
+	TTFBMs        int64         `json:"ttfb_ms"` // 请求写出到收到首字节的耗时
+	TransferMs    int64         `json:"transfer_ms"` // 读取响应体耗时
+	ConnReused    bool          `json:"conn_reused"` // 是否复用了连接
+	RemoteIP      string        `json:"remote_ip"` // 实际连接的对端IP
+	RequestSnapshot string      `json:"request_snapshot"` // JSON 格式的脱敏请求快照
 	CreatedAt     time.Time     `json:"created_at"`
 }
 
@@ -65,6 +78,66 @@ type NotificationTask struct {
 	MaxAttempts    int           `json:"max_attempts"`
 	AttemptCount   int           `json:"attempt_count"` // 当前尝试次数
 	SuccessCondition string       `json:"success_condition"` // 自定义成功条件
+	Timeouts       string        `json:"timeouts"` // JSON 格式的超时覆盖（TaskTimeouts）
+	EventType      string        `json:"event_type"` // 事件类型，随身份头发送
+	CallbackURL    string        `json:"callback_url"` // 到达终态后接收状态回调的地址
+	TemplateName   string        `json:"template_name"` // 合作方模板名称，派发时渲染
+	TemplateData   string        `json:"template_data"` // JSON 格式的模板数据
+	BodyEncoding   string        `json:"body_encoding"` // 请求体编码方式，空值等同于json
+	BodyRef        string        `json:"body_ref"` // 请求体在blob存储中的引用，非空时Body为空，由派发器按需加载
+	ExpiresAt      *time.Time    `json:"expires_at"` // 过期时间，到期仍未成功的任务不再投递，为nil时不过期
 	CreatedAt      time.Time     `json:"created_at"`
 	UpdatedAt      time.Time     `json:"updated_at"`
-}
\ No newline at end of file
+}
+
+// TaskTimeouts 请求超时设置（毫秒），0表示不覆盖
+// 用于合作方配置和任务级覆盖，生效顺序：任务 > 合作方 > 全局默认
+type TaskTimeouts struct {
+	ConnectMs        int `json:"connect_ms,omitempty"`
+	TLSHandshakeMs   int `json:"tls_handshake_ms,omitempty"`
+	ResponseHeaderMs int `json:"response_header_ms,omitempty"`
+	TotalMs          int `json:"total_ms,omitempty"`
+}
+
+// Template 合作方注册的请求模板（Go text/template语法）
+type Template struct {
+	ID              uint64    `json:"id"`
+	PartnerID       string    `json:"partner_id"`
+	Name            string    `json:"name"`
+	BodyTemplate    string    `json:"body_template"` // 请求体模板
+	HeadersTemplate string    `json:"headers_template"` // JSON 对象，值为请求头模板
+	URLTemplate     string    `json:"url_template"` // 路径和查询参数模板，相对任务目标URL解析
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// PartnerSecret 合作方密钥，值以主密钥加密后保存，用于替换{{NAME}}占位符
+type PartnerSecret struct {
+	ID         uint64    `json:"id"`
+	PartnerID  string    `json:"partner_id"`
+	Name       string    `json:"name"`
+	Ciphertext string    `json:"-"` // 加密后的密钥值
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SigningSecretStatus 签名密钥状态
+type SigningSecretStatus string
+
+const (
+	// SigningSecretStatusActive 有效（到达expires_at前仍参与签名）
+	SigningSecretStatusActive SigningSecretStatus = "active"
+	// SigningSecretStatusRevoked 已吊销
+	SigningSecretStatusRevoked SigningSecretStatus = "revoked"
+)
+
+// SigningSecret 合作方Webhook签名密钥
+type SigningSecret struct {
+	ID        uint64              `json:"id"`
+	SecretID  string              `json:"secret_id"`
+	PartnerID string              `json:"partner_id"`
+	Secret    string              `json:"-"` // whsec_前缀的base64密钥，仅在创建时返回
+	Status    SigningSecretStatus `json:"status"`
+	ExpiresAt *time.Time          `json:"expires_at,omitempty"` // 轮换后旧密钥的失效时间
+	CreatedAt time.Time           `json:"created_at"`
+}
@@ -0,0 +1,205 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"api-notify/internal/metrics"
+	"api-notify/pkg/httpclient"
+)
+
+// Outcome 一次投递对并发控制器而言的结果分类
+type Outcome int
+
+const (
+	// OutcomeSuccess 投递完成且延迟健康
+	OutcomeSuccess Outcome = iota
+	// OutcomeSlow 投递完成但延迟超过阈值
+	OutcomeSlow
+	// OutcomeOverload 超时、5xx或429，说明接收方已过载
+	OutcomeOverload
+	// OutcomeNeutral 未完成投递（如读取任务信息失败），只释放槽位，不调整并发上限
+	OutcomeNeutral
+)
+
+// LimiterSettings 自适应并发控制器参数
+type LimiterSettings struct {
+	InitialLimit     int
+	MinLimit         int
+	MaxLimit         int
+	LatencyThreshold time.Duration
+	BackoffRatio     float64
+	MinSuccessRate   float64
+}
+
+// AdaptiveLimiter 按目标主机的AIMD并发控制器
+// 延迟和成功率健康时线性增加允许的在途请求数，遇到超时/5xx/429时按比例削减
+type AdaptiveLimiter struct {
+	mu       sync.Mutex
+	hosts    map[string]*hostLimit
+	settings LimiterSettings
+	metrics  metrics.Metrics
+}
+
+// hostLimit 单个主机的并发状态
+type hostLimit struct {
+	limit       float64
+	inFlight    int
+	successRate float64 // 成功率的指数加权移动平均
+}
+
+// successRateAlpha 成功率EWMA的平滑系数
+const successRateAlpha = 0.1
+
+// NewAdaptiveLimiter 创建自适应并发控制器
+func NewAdaptiveLimiter(settings LimiterSettings, m metrics.Metrics) *AdaptiveLimiter {
+	if settings.MinLimit < 1 {
+		settings.MinLimit = 1
+	}
+	if settings.MaxLimit < settings.MinLimit {
+		settings.MaxLimit = settings.MinLimit
+	}
+	if settings.InitialLimit < settings.MinLimit {
+		settings.InitialLimit = settings.MinLimit
+	}
+	if settings.InitialLimit > settings.MaxLimit {
+		settings.InitialLimit = settings.MaxLimit
+	}
+	if settings.BackoffRatio <= 0 || settings.BackoffRatio >= 1 {
+		settings.BackoffRatio = 0.5
+	}
+
+	return &AdaptiveLimiter{
+		hosts:    make(map[string]*hostLimit),
+		settings: settings,
+		metrics:  m,
+	}
+}
+
+// TryAcquire 尝试为目标主机占用一个并发槽位，已达上限时返回false
+func (l *AdaptiveLimiter) TryAcquire(host string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h := l.getHost(host)
+	if h.inFlight >= int(h.limit) {
+		return false
+	}
+	h.inFlight++
+	return true
+}
+
+// Release 释放槽位并根据投递结果调整该主机的并发上限
+func (l *AdaptiveLimiter) Release(host string, outcome Outcome) {
+	l.mu.Lock()
+	h := l.getHost(host)
+	if h.inFlight > 0 {
+		h.inFlight--
+	}
+	if outcome == OutcomeNeutral {
+		l.mu.Unlock()
+		return
+	}
+
+	success := 0.0
+	if outcome != OutcomeOverload {
+		success = 1.0
+	}
+	h.successRate = h.successRate*(1-successRateAlpha) + success*successRateAlpha
+
+	switch {
+	case outcome == OutcomeOverload:
+		// 乘性减少
+		h.limit *= l.settings.BackoffRatio
+	case outcome == OutcomeSuccess && h.successRate >= l.settings.MinSuccessRate:
+		// 加性增加：每个“窗口”（约limit次成功）增加1
+		h.limit += 1 / h.limit
+	}
+
+	if h.limit < float64(l.settings.MinLimit) {
+		h.limit = float64(l.settings.MinLimit)
+	}
+	if h.limit > float64(l.settings.MaxLimit) {
+		h.limit = float64(l.settings.MaxLimit)
+	}
+	limit := int(h.limit)
+	l.mu.Unlock()
+
+	if l.metrics != nil {
+		l.metrics.SetConcurrencyLimit(host, limit)
+	}
+}
+
+// deliveryError 投递通道发送请求时返回的错误，用于和发送前的本地错误（模板渲染、密钥查找、OAuth2令牌获取等）区分
+type deliveryError struct {
+	err error
+}
+
+func (e *deliveryError) Error() string { return e.err.Error() }
+
+func (e *deliveryError) Unwrap() error { return e.err }
+
+// Classify 根据延迟、响应码和错误给出投递结果分类
+// 只有发送请求时的超时和网络错误算过载，本地错误和被出站策略拒绝的请求不调整并发上限
+func (l *AdaptiveLimiter) Classify(statusCode int, latency time.Duration, err error) Outcome {
+	if err != nil {
+		if isOverloadError(err) {
+			return OutcomeOverload
+		}
+		return OutcomeNeutral
+	}
+	if statusCode == 429 || statusCode >= 500 {
+		return OutcomeOverload
+	}
+	if l.settings.LatencyThreshold > 0 && latency > l.settings.LatencyThreshold {
+		return OutcomeSlow
+	}
+	return OutcomeSuccess
+}
+
+// isOverloadError 判断发送请求的错误是否说明接收方不可用：超时、连接被拒绝/重置、连接被提前关闭
+// 域名解析失败、证书错误、重定向超限等不反映接收方负载
+func isOverloadError(err error) bool {
+	var delivery *deliveryError
+	if !errors.As(err, &delivery) || errors.Is(err, httpclient.ErrBlockedDestination) {
+		return false
+	}
+	if errors.Is(err, httpclient.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// getHost 获取主机状态，不存在时按初始值创建（调用方需持有锁）
+func (l *AdaptiveLimiter) getHost(host string) *hostLimit {
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostLimit{
+			limit:       float64(l.settings.InitialLimit),
+			successRate: 1,
+		}
+		l.hosts[host] = h
+	}
+	return h
+}
+
+// targetHost 提取目标URL的主机（含端口），用作并发控制的维度
+func targetHost(targetURL string) string {
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil || parsedURL.Host == "" {
+		return targetURL
+	}
+	return strings.ToLower(parsedURL.Host)
+}
@@ -0,0 +1,197 @@
+package dispatcher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"api-notify/pkg/httpclient"
+)
+
+// redactedValue 脱敏后的占位值
+const redactedValue = "[REDACTED]"
+
+// sensitiveKeyParts JSON字段名包含这些片段时视为敏感字段
+var sensitiveKeyParts = []string{"password", "passwd", "secret", "token", "authorization", "api_key", "apikey", "credential"}
+
+// sensitiveKeyValuePattern 匹配 "key": "value" 和 key=value 形式中字段名敏感的值，
+// 用于无法按JSON解析的响应体（如超过读取上限被截断的JSON、表单格式）
+var sensitiveKeyValuePattern = regexp.MustCompile(`(?i)("?[\w.\-]*(?:` + strings.Join(sensitiveKeyParts, "|") + `)[\w.\-]*"?\s*[:=]\s*)("(?:[^"\\]|\\.)*"?|[^\s,&;}\]]*)`)
+
+// captureResponse 提取尝试记录中保存的响应体和响应头（脱敏、截断）
+func captureResponse(resp *httpclient.Response, maxBytes int, headerNames []string) (string, string) {
+	body := string(redactJSONBody(resp.Body))
+	truncated := resp.Truncated
+	if maxBytes > 0 && len(body) > maxBytes {
+		body = body[:maxBytes]
+		truncated = true
+	}
+	body = strings.ToValidUTF8(body, "")
+	if truncated {
+		body += "...[truncated]"
+	}
+
+	headers := make(map[string]string)
+	for _, name := range headerNames {
+		value := resp.Headers.Get(name)
+		if value == "" {
+			continue
+		}
+		if isSensitiveHeader(http.CanonicalHeaderKey(name)) {
+			value = redactedValue
+		}
+		headers[http.CanonicalHeaderKey(name)] = value
+	}
+
+	headersJSON := ""
+	if len(headers) > 0 {
+		if data, err := json.Marshal(headers); err == nil {
+			headersJSON = string(data)
+		}
+	}
+
+	return body, headersJSON
+}
+
+// redactJSONBody 将JSON中的敏感字段替换为占位值，无法按JSON解析的内容按字段名匹配脱敏
+func redactJSONBody(body []byte) []byte {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return redactKeyValues(body)
+	}
+
+	if !redactJSONValue(value) {
+		return body
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return body
+	}
+	return data
+}
+
+// redactKeyValues 按字段名脱敏文本中的 "key": "value" 和 key=value，带引号的值保留引号
+func redactKeyValues(body []byte) []byte {
+	return sensitiveKeyValuePattern.ReplaceAllFunc(body, func(match []byte) []byte {
+		parts := sensitiveKeyValuePattern.FindSubmatch(match)
+		value := redactedValue
+		if len(parts[2]) > 0 && parts[2][0] == '"' {
+			value = `"` + redactedValue + `"`
+		}
+		return append(append([]byte(nil), parts[1]...), value...)
+	})
+}
+
+// redactJSONValue 递归脱敏JSON值，返回是否有字段被替换
+func redactJSONValue(value interface{}) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if isSensitiveKey(key) {
+				v[key] = redactedValue
+				changed = true
+				continue
+			}
+			if redactJSONValue(child) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if redactJSONValue(child) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// isSensitiveKey 判断JSON字段名是否敏感
+func isSensitiveKey(key string) bool {
+	lower := strings.ToLower(key)
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestSnapshot 实际发送的请求快照，敏感值已脱敏，请求体只保留摘要和大小（压缩时为压缩后的请求体）
+type requestSnapshot struct {
+	Method     string            `json:"method"`
+	URL        string            `json:"url"`
+	Headers    map[string]string `json:"headers"`
+	BodySHA256 string            `json:"body_sha256"`
+	BodySize   int               `json:"body_size"`
+}
+
+// snapshotRequest 生成请求快照的JSON，由占位符替换得到真实值的头和URL中的密钥均脱敏
+func snapshotRequest(method, targetURL string, headers map[string]string, body []byte, secrets *resolvedSecrets) string {
+	snapshot := requestSnapshot{
+		Method:   method,
+		URL:      redactURL(secrets.redact(targetURL)),
+		Headers:  make(map[string]string, len(headers)),
+		BodySize: len(body),
+	}
+
+	for key, value := range headers {
+		name := http.CanonicalHeaderKey(key)
+		if secrets.headers[name] || isSensitiveHeader(name) || isSensitiveKey(name) {
+			value = redactedValue
+		}
+		snapshot.Headers[name] = value
+	}
+	// 与httpclient保持一致：有请求体且未指定Content-Type时默认为JSON
+	if _, ok := snapshot.Headers["Content-Type"]; !ok && len(body) > 0 {
+		snapshot.Headers["Content-Type"] = "application/json"
+	}
+
+	sum := sha256.Sum256(body)
+	snapshot.BodySHA256 = hex.EncodeToString(sum[:])
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// redactRedirectChain 返回写入尝试记录的重定向链，URL中的密码和敏感查询参数已脱敏
+func redactRedirectChain(hops []httpclient.Redirect) []httpclient.Redirect {
+	redacted := make([]httpclient.Redirect, len(hops))
+	for i, hop := range hops {
+		redacted[i] = hop
+		redacted[i].From = redactURL(hop.From)
+		redacted[i].To = redactURL(hop.To)
+	}
+	return redacted
+}
+
+// redactURL 脱敏URL中的密码和敏感查询参数
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	query := parsed.Query()
+	changed := false
+	for key := range query {
+		if isSensitiveKey(key) {
+			query.Set(key, redactedValue)
+			changed = true
+		}
+	}
+	if changed {
+		parsed.RawQuery = query.Encode()
+	}
+
+	return parsed.Redacted()
+}
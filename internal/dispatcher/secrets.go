@@ -0,0 +1,191 @@
+package dispatcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"api-notify/internal/core"
+	"api-notify/internal/payload"
+	"api-notify/pkg/httpclient"
+)
+
+// placeholderPattern 密钥占位符格式 {{NAME}}
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+// resolvedSecrets 本次请求中替换进去的密钥，用于在快照、日志和错误信息中脱敏
+type resolvedSecrets struct {
+	// headers 由占位符替换得到真实值的请求头
+	headers map[string]bool
+	// values 替换进去的密钥值
+	values []string
+}
+
+// newResolvedSecrets 创建空的密钥记录
+func newResolvedSecrets() *resolvedSecrets {
+	return &resolvedSecrets{headers: make(map[string]bool)}
+}
+
+// add 记录使用过的密钥值
+func (s *resolvedSecrets) add(value string) {
+	if value == "" {
+		return
+	}
+	for _, v := range s.values {
+		if v == value {
+			return
+		}
+	}
+	s.values = append(s.values, value)
+}
+
+// redact 将文本中出现的密钥值（含URL转义和JSON转义形式）替换为占位值
+func (s *resolvedSecrets) redact(text string) string {
+	for _, value := range s.values {
+		for _, form := range []string{value, url.QueryEscape(value), url.PathEscape(value), jsonEscape(value)} {
+			text = strings.ReplaceAll(text, form, redactedValue)
+		}
+	}
+	return text
+}
+
+// redactRedirects 脱敏重定向链中替换进去的密钥，保留URL中的其他部分用于更新目标地址
+func (s *resolvedSecrets) redactRedirects(hops []httpclient.Redirect) {
+	for i := range hops {
+		hops[i].From = s.redact(hops[i].From)
+		hops[i].To = s.redact(hops[i].To)
+	}
+}
+
+// redactedError 错误信息中的密钥已脱敏，保留原错误用于errors.Is判断
+type redactedError struct {
+	err     error
+	message string
+}
+
+func (e *redactedError) Error() string { return e.message }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactError 脱敏错误信息（如url.Error中包含的请求URL）
+func (s *resolvedSecrets) redactError(err error) error {
+	if err == nil || len(s.values) == 0 {
+		return err
+	}
+	message := s.redact(err.Error())
+	if message == err.Error() {
+		return err
+	}
+	return &redactedError{err: err, message: message}
+}
+
+// substitute 替换文本中的占位符，escape为nil时原样插入密钥值；找不到密钥的占位符保留原样
+func (w *Worker) substitute(ctx context.Context, task *core.NotificationTask, text string, escape func(string) string, secrets *resolvedSecrets) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	var lookupErr error
+	result := placeholderPattern.ReplaceAllStringFunc(text, func(match string) string {
+		if lookupErr != nil {
+			return match
+		}
+		name := placeholderPattern.FindStringSubmatch(match)[1]
+		value, ok, err := w.lookupSecret(ctx, task, name)
+		if err != nil {
+			lookupErr = err
+			return match
+		}
+		if !ok {
+			w.logger.Warn("Secret placeholder not found for task %s, partner %s: %s", task.TaskID, task.PartnerID, name)
+			return match
+		}
+		secrets.add(value)
+		if escape != nil {
+			return escape(value)
+		}
+		return value
+	})
+	if lookupErr != nil {
+		return "", fmt.Errorf("failed to resolve secret placeholder: %w", lookupErr)
+	}
+	return result, nil
+}
+
+// substituteURL 替换URL中的占位符，路径部分按路径转义，查询参数部分按查询参数转义
+func (w *Worker) substituteURL(ctx context.Context, task *core.NotificationTask, rawURL string, secrets *resolvedSecrets) (string, error) {
+	path, query, hasQuery := strings.Cut(rawURL, "?")
+	path, err := w.substitute(ctx, task, path, url.PathEscape, secrets)
+	if err != nil || !hasQuery {
+		return path, err
+	}
+	query, err = w.substitute(ctx, task, query, url.QueryEscape, secrets)
+	if err != nil {
+		return "", err
+	}
+	return path + "?" + query, nil
+}
+
+// substituteBody 按请求体编码方式替换占位符：JSON中按字符串转义，表单中按字段解码后替换再URL转义，文本原样插入，二进制不替换
+func (w *Worker) substituteBody(ctx context.Context, task *core.NotificationTask, secrets *resolvedSecrets) (string, error) {
+	switch task.BodyEncoding {
+	case "", payload.EncodingJSON:
+		return w.substitute(ctx, task, task.Body, jsonEscape, secrets)
+	case payload.EncodingForm:
+		return w.substituteForm(ctx, task, task.Body, secrets)
+	case payload.EncodingText:
+		return w.substitute(ctx, task, task.Body, nil, secrets)
+	default:
+		return task.Body, nil
+	}
+}
+
+// substituteForm 替换表单中的占位符，字段顺序不变，不含占位符的字段保持原样
+// 任务中保存的表单已经过URL编码（{{NAME}}保存为%7B%7BNAME%7D%7D），需按字段解码后再匹配占位符
+func (w *Worker) substituteForm(ctx context.Context, task *core.NotificationTask, body string, secrets *resolvedSecrets) (string, error) {
+	if body == "" {
+		return body, nil
+	}
+
+	pairs := strings.Split(body, "&")
+	for i, pair := range pairs {
+		rawKey, rawValue, hasValue := strings.Cut(pair, "=")
+		key, keyErr := url.QueryUnescape(rawKey)
+		value, valueErr := url.QueryUnescape(rawValue)
+		if keyErr != nil || valueErr != nil || !strings.Contains(key+value, "{{") {
+			// 无法解码的字段原样发送
+			continue
+		}
+
+		key, err := w.substitute(ctx, task, key, nil, secrets)
+		if err != nil {
+			return "", err
+		}
+		value, err = w.substitute(ctx, task, value, nil, secrets)
+		if err != nil {
+			return "", err
+		}
+		pairs[i] = url.QueryEscape(key)
+		if hasValue {
+			pairs[i] += "=" + url.QueryEscape(value)
+		}
+	}
+	return strings.Join(pairs, "&"), nil
+}
+
+// lookupSecret 按任务所属合作方查找占位符对应的密钥值，任务不能引用其他合作方的密钥
+func (w *Worker) lookupSecret(ctx context.Context, task *core.NotificationTask, name string) (string, bool, error) {
+	return w.secrets.GetForTask(ctx, task.PartnerID, task.TaskID, name)
+}
+
+// jsonEscape 将字符串转义为可放入JSON字符串内的形式（不含两侧引号）
+func jsonEscape(value string) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	return string(data[1 : len(data)-1])
+}
@@ -0,0 +1,213 @@
+package dispatcher
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+
+	"api-notify/internal/security"
+	"api-notify/internal/signing"
+	"api-notify/pkg/httpclient"
+	"api-notify/pkg/logging"
+)
+
+// smtpStatusOK 投递成功时记录的状态码（SMTP 250应答）
+const smtpStatusOK = 250
+
+// SMTPSettings SMTP投递通道配置
+type SMTPSettings struct {
+	Addr       string
+	Username   string
+	Password   string
+	From       string
+	RequireTLS bool
+	Timeout    time.Duration
+}
+
+// SMTPTransport 通过SMTP投递mailto:目标，请求体作为邮件正文
+// 主题取自mailto的subject参数或Subject请求头；签名相关的请求头原样写入邮件头，便于收件方验签
+// SMTP应答码记录为状态码：2xx成功，4xx/5xx按失败重试
+type SMTPTransport struct {
+	settings SMTPSettings
+	logger   *logging.Logger
+}
+
+// NewSMTPTransport 创建SMTP投递通道
+func NewSMTPTransport(settings SMTPSettings, logger *logging.Logger) *SMTPTransport {
+	return &SMTPTransport{settings: settings, logger: logger}
+}
+
+// mailHeaders 从请求头复制到邮件头的字段
+var mailHeaders = []string{
+	signing.HeaderWebhookID,
+	signing.HeaderWebhookTimestamp,
+	signing.HeaderWebhookSignature,
+	signing.HeaderWebhookKeyID,
+}
+
+// Send 发送邮件
+func (t *SMTPTransport) Send(ctx context.Context, r *httpclient.Request) (*httpclient.Response, error) {
+	startTime := time.Now()
+
+	target, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mailto url: %w", err)
+	}
+	recipients, err := security.MailtoRecipients(target)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := t.settings.Timeout
+	if r.Timeouts.Total > 0 {
+		timeout = r.Timeouts.Total
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	message := t.buildMessage(target, recipients, r)
+	if err := t.deliver(ctx, recipients, message); err != nil {
+		// 服务器的拒绝应答记录为状态码，连接类错误按请求失败处理
+		var replyErr *textproto.Error
+		if errors.As(err, &replyErr) {
+			return &httpclient.Response{
+				StatusCode: replyErr.Code,
+				Body:       []byte(replyErr.Msg),
+				Latency:    time.Since(startTime),
+			}, nil
+		}
+		return nil, err
+	}
+
+	t.logger.Debug("Mail sent to %d recipient(s) via %s, Latency: %v", len(recipients), t.settings.Addr, time.Since(startTime))
+	return &httpclient.Response{
+		StatusCode: smtpStatusOK,
+		Latency:    time.Since(startTime),
+	}, nil
+}
+
+// deliver 连接SMTP服务器并投递邮件
+func (t *SMTPTransport) deliver(ctx context.Context, recipients []string, message []byte) error {
+	host, _, err := net.SplitHostPort(t.settings.Addr)
+	if err != nil {
+		return fmt.Errorf("invalid smtp address %q: %w", t.settings.Addr, err)
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", t.settings.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect smtp server: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to create smtp client: %w", err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return fmt.Errorf("smtp starttls failed: %w", err)
+		}
+	} else if t.settings.RequireTLS {
+		return fmt.Errorf("smtp server %s does not support STARTTLS", t.settings.Addr)
+	}
+
+	if t.settings.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", t.settings.Username, t.settings.Password, host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(t.settings.From); err != nil {
+		return err
+	}
+	for _, recipient := range recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// buildMessage 构造邮件内容，正文使用base64编码以避免超长行
+func (t *SMTPTransport) buildMessage(target *url.URL, recipients []string, r *httpclient.Request) []byte {
+	headers := http.Header{}
+	for key, value := range r.Headers {
+		headers.Set(key, value)
+	}
+
+	subject := target.Query().Get("subject")
+	if subject == "" {
+		subject = headers.Get("Subject")
+	}
+	if subject == "" {
+		subject = "Notification " + headers.Get(signing.HeaderWebhookID)
+	}
+
+	contentType := headers.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json; charset=utf-8"
+	}
+
+	var buf bytes.Buffer
+	writeHeader := func(name, value string) {
+		// 去除换行，防止邮件头注入
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+
+	writeHeader("From", t.settings.From)
+	writeHeader("To", strings.Join(recipients, ", "))
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", subject))
+	writeHeader("Date", time.Now().Format(time.RFC1123Z))
+	writeHeader("MIME-Version", "1.0")
+	writeHeader("Content-Type", contentType)
+	writeHeader("Content-Transfer-Encoding", "base64")
+	for _, name := range mailHeaders {
+		if value := headers.Get(name); value != "" {
+			writeHeader(http.CanonicalHeaderKey(name), value)
+		}
+	}
+	buf.WriteString("\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString(r.Body)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	if encoded != "" {
+		buf.WriteString(encoded + "\r\n")
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,188 @@
+package dispatcher
+
+import (
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"api-notify/internal/signing"
+	"api-notify/pkg/httpclient"
+	"api-notify/pkg/logging"
+)
+
+// fakeSMTPServer 测试用的SMTP服务器，不支持STARTTLS，记录收到的命令和邮件内容
+type fakeSMTPServer struct {
+	listener net.Listener
+	// rcptReply 对RCPT命令的应答，为空时返回250
+	rcptReply string
+
+	mu       sync.Mutex
+	commands []string
+	messages []string
+}
+
+// newFakeSMTPServer 启动SMTP服务器
+func newFakeSMTPServer(t *testing.T, rcptReply string) *fakeSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTPServer{listener: listener, rcptReply: rcptReply}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// serve 处理一个SMTP会话
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	tp.PrintfLine("220 fake.test ESMTP")
+
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.Fields(line + " ")[0])
+		s.mu.Lock()
+		s.commands = append(s.commands, verb)
+		s.mu.Unlock()
+
+		switch verb {
+		case "EHLO":
+			tp.PrintfLine("250-fake.test")
+			tp.PrintfLine("250 8BITMIME")
+		case "MAIL":
+			tp.PrintfLine("250 ok")
+		case "RCPT":
+			if s.rcptReply != "" {
+				tp.PrintfLine("%s", s.rcptReply)
+			} else {
+				tp.PrintfLine("250 ok")
+			}
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, strings.Join(lines, "\n"))
+			s.mu.Unlock()
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+// received 返回收到的命令和邮件
+func (s *fakeSMTPServer) received() ([]string, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...), append([]string(nil), s.messages...)
+}
+
+// newTestSMTPTransport 创建连接到测试服务器的SMTP投递通道
+func newTestSMTPTransport(server *fakeSMTPServer, requireTLS bool) *SMTPTransport {
+	return NewSMTPTransport(SMTPSettings{
+		Addr:       server.listener.Addr().String(),
+		From:       "notify@sender.test",
+		RequireTLS: requireTLS,
+		Timeout:    5 * time.Second,
+	}, logging.New("error"))
+}
+
+func TestSMTPRequireTLSRefusesPlaintextServer(t *testing.T) {
+	server := newFakeSMTPServer(t, "")
+	transport := newTestSMTPTransport(server, true)
+
+	resp, err := transport.Send(context.Background(), &httpclient.Request{
+		URL:  "mailto:ops@receiver.test",
+		Body: []byte(`{"event":"test"}`),
+	})
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("Send() = %v, %v; want STARTTLS error", resp, err)
+	}
+
+	commands, messages := server.received()
+	for _, command := range commands {
+		if command == "MAIL" || command == "DATA" {
+			t.Fatalf("server received %s without TLS: %v", command, commands)
+		}
+	}
+	if len(messages) != 0 {
+		t.Fatalf("server received %d messages without TLS", len(messages))
+	}
+}
+
+func TestSMTPRejectionMappedToStatusCode(t *testing.T) {
+	server := newFakeSMTPServer(t, "550 5.1.1 mailbox unavailable")
+	transport := newTestSMTPTransport(server, false)
+
+	resp, err := transport.Send(context.Background(), &httpclient.Request{
+		URL:  "mailto:nobody@receiver.test",
+		Body: []byte(`{"event":"test"}`),
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v, want rejection as response", err)
+	}
+	if resp.StatusCode != 550 {
+		t.Fatalf("StatusCode = %d, want 550", resp.StatusCode)
+	}
+	if !strings.Contains(string(resp.Body), "mailbox unavailable") {
+		t.Fatalf("Body = %q, want the server reply", resp.Body)
+	}
+}
+
+func TestSMTPStripsHeaderInjection(t *testing.T) {
+	server := newFakeSMTPServer(t, "")
+	transport := newTestSMTPTransport(server, false)
+
+	resp, err := transport.Send(context.Background(), &httpclient.Request{
+		URL: "mailto:ops@receiver.test",
+		Headers: map[string]string{
+			"Subject":               "hello\r\nBcc: victim@evil.test",
+			signing.HeaderWebhookID: "msg_1\r\nBcc: victim@evil.test",
+		},
+		Body: []byte(`{"event":"test"}`),
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if resp.StatusCode != smtpStatusOK {
+		t.Fatalf("StatusCode = %d, want %d", resp.StatusCode, smtpStatusOK)
+	}
+
+	_, messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(messages))
+	}
+	header, _, _ := strings.Cut(messages[0], "\n\n")
+	for _, line := range strings.Split(header, "\n") {
+		if strings.HasPrefix(strings.ToLower(line), "bcc:") {
+			t.Fatalf("injected header line %q in message:\n%s", line, header)
+		}
+	}
+	if !strings.Contains(header, "Webhook-Id: msg_1Bcc: victim@evil.test") {
+		t.Fatalf("webhook-id header not sanitized:\n%s", header)
+	}
+}
@@ -0,0 +1,43 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"api-notify/pkg/httpclient"
+)
+
+// ErrUnsupportedScheme 目标URL的协议没有对应的投递通道
+var ErrUnsupportedScheme = errors.New("unsupported target scheme")
+
+// ErrBodyUnavailable 保存在blob存储中的请求体无法加载
+var ErrBodyUnavailable = errors.New("task body unavailable")
+
+// Transport 投递通道，按目标URL的协议选择
+// 请求和结果沿用httpclient的结构：非HTTP通道只使用其中适用的字段，
+// 并把通道自身的结果码映射到StatusCode（如SMTP应答码），由统一的成功判定和重试逻辑处理
+type Transport interface {
+	Send(ctx context.Context, r *httpclient.Request) (*httpclient.Response, error)
+}
+
+// RegisterTransport 注册协议对应的投递通道，覆盖该协议已有的通道
+func (w *Worker) RegisterTransport(scheme string, transport Transport) {
+	w.transports[strings.ToLower(scheme)] = transport
+}
+
+// transportFor 按目标URL的协议选择投递通道
+func (w *Worker) transportFor(targetURL string) (Transport, error) {
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse target url: %w", err)
+	}
+
+	transport, ok := w.transports[strings.ToLower(parsedURL.Scheme)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedScheme, parsedURL.Scheme)
+	}
+	return transport, nil
+}
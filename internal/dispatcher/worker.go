@@ -3,11 +3,23 @@ package dispatcher
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"api-notify/internal/callback"
 	"api-notify/internal/config"
 	"api-notify/internal/core"
+	"api-notify/internal/metrics"
+	"api-notify/internal/oauth2"
+	"api-notify/internal/payload"
+	"api-notify/internal/render"
+	"api-notify/internal/secrets"
+	"api-notify/internal/security"
+	"api-notify/internal/signing"
 	"api-notify/internal/store"
 	"api-notify/pkg/httpclient"
 	"api-notify/pkg/logging"
@@ -22,6 +34,14 @@ type Worker struct {
 	store     *store.Store
 	httpClient *httpclient.Client
 	config    *config.Config
+	metrics   metrics.Metrics
+	limiter   *AdaptiveLimiter // 按目标主机的自适应并发控制，未启用时为nil
+	keyring   *signing.Ed25519Keyring
+	tokens    *oauth2.TokenCache // 合作方OAuth2访问令牌缓存
+	policy    *security.Policy
+	secrets   *secrets.Resolver // 占位符密钥解析（合作方密钥库、环境变量、文件、密钥服务等来源）
+	// transports 按目标URL协议索引的投递通道
+	transports map[string]Transport
 	stopCh    chan struct{}
 	// Sub-struct for configuration
 	settings struct {
@@ -29,27 +49,60 @@ type Worker struct {
 		Interval          time.Duration
 		BatchSize         int
 		RetryBackoff      time.Duration
-		SensitiveHeaders  map[string]string
+		DeferDelay        time.Duration
 	}
 }
 
 // NewWorker 创建新的Worker实例
 
-func NewWorker(logger *logging.Logger, store *store.Store, httpClient *httpclient.Client, config *config.Config) *Worker {
+func NewWorker(logger *logging.Logger, store *store.Store, httpClient *httpclient.Client, config *config.Config, m metrics.Metrics, keyring *signing.Ed25519Keyring, policy *security.Policy, secretResolver *secrets.Resolver) *Worker {
 	worker := &Worker{
 		logger:     logger,
 		store:      store,
 		httpClient: httpClient,
 		config:     config,
+		metrics:    m,
+		keyring:    keyring,
+		tokens:     oauth2.NewTokenCache(httpClient, logger),
+		policy:     policy,
+		secrets:    secretResolver,
+		transports: make(map[string]Transport),
 		stopCh:     make(chan struct{}),
 	}
+
+	// 注册投递通道：HTTP(S)和Unix域套接字HTTP由httpClient处理，配置了SMTP时支持mailto
+	worker.RegisterTransport("http", httpClient)
+	worker.RegisterTransport("https", httpClient)
+	worker.RegisterTransport(httpclient.SchemeHTTPUnix, httpClient)
+	if config.SMTP.Addr != "" {
+		worker.RegisterTransport("mailto", NewSMTPTransport(SMTPSettings{
+			Addr:       config.SMTP.Addr,
+			Username:   config.SMTP.Username,
+			Password:   config.SMTP.Password,
+			From:       config.SMTP.From,
+			RequireTLS: config.SMTP.RequireTLS,
+			Timeout:    config.SMTP.Timeout,
+		}, logger))
+	}
 	
 	// Populate configuration sub-struct
 	worker.settings.ConcurrentWorkers = config.Worker.Concurrency
 	worker.settings.Interval = config.Worker.PollInterval
 	worker.settings.BatchSize = 100 // Default batch size
 	worker.settings.RetryBackoff = 5 * time.Second // Default retry backoff
-	worker.settings.SensitiveHeaders = config.Security.SensitiveHeaders
+	worker.settings.DeferDelay = config.Worker.Adaptive.DeferDelay
+
+	// 初始化自适应并发控制器
+	if config.Worker.Adaptive.Enabled {
+		worker.limiter = NewAdaptiveLimiter(LimiterSettings{
+			InitialLimit:     config.Worker.Adaptive.InitialLimit,
+			MinLimit:         config.Worker.Adaptive.MinLimit,
+			MaxLimit:         config.Worker.Adaptive.MaxLimit,
+			LatencyThreshold: config.Worker.Adaptive.LatencyThreshold,
+			BackoffRatio:     config.Worker.Adaptive.BackoffRatio,
+			MinSuccessRate:   config.Worker.Adaptive.MinSuccessRate,
+		}, m)
+	}
 	
 	return worker
 }
@@ -118,6 +171,20 @@ func (w *Worker) processTasks(ctx context.Context) {
 
 // processTask 处理单个任务
 func (w *Worker) processTask(ctx context.Context, task *core.NotificationTask) {
+	// 目标主机并发已达上限时推迟任务，不计入尝试次数
+	host := targetHost(task.TargetURL)
+	outcome := OutcomeNeutral
+	if w.limiter != nil {
+		if !w.limiter.TryAcquire(host) {
+			w.deferTask(ctx, task, host)
+			return
+		}
+		// 未完成投递就返回时以中性结果释放槽位
+		defer func() {
+			w.limiter.Release(host, outcome)
+		}()
+	}
+
 	// 获取当前尝试次数
 	attemptCount, err := w.store.GetAttemptCount(ctx, task.TaskID)
 	if err != nil {
@@ -135,23 +202,67 @@ func (w *Worker) processTask(ctx context.Context, task *core.NotificationTask) {
 
 	// 发送通知并记录延迟
 	startTime := time.Now()
-	success, responseCode, _, err := w.sendNotification(ctx, task) // 使用 _ 忽略 responseBody
+	success, resp, err := w.sendNotification(ctx, task, attempt)
 	latency := time.Since(startTime)
 
+	responseCode := 0
+	if resp != nil {
+		responseCode = resp.StatusCode
+	}
+
+	// 根据结果调整目标主机的并发上限（任务处理结束时释放槽位）
+	if w.limiter != nil {
+		outcome = w.limiter.Classify(responseCode, latency, err)
+	}
+
 	if err != nil {
 		w.logger.Error("Failed to send notification for task %s: %v", task.TaskID, err)
 		attempt.ErrorMessage = err.Error()
 		// 设置通用错误码
 		attempt.ErrorCode = "HTTP_REQUEST_FAILED"
-		if err.Error() == "context deadline exceeded" {
+		if errors.Is(err, httpclient.ErrTimeout) || errors.Is(err, context.DeadlineExceeded) {
 			attempt.ErrorCode = "HTTP_REQUEST_TIMEOUT"
 		}
+		if errors.Is(err, ErrUnsupportedScheme) {
+			attempt.ErrorCode = "UNSUPPORTED_SCHEME"
+		}
+		if errors.Is(err, render.ErrRender) {
+			attempt.ErrorCode = "TEMPLATE_RENDER_FAILED"
+		}
+		if errors.Is(err, ErrBodyUnavailable) {
+			attempt.ErrorCode = "BODY_UNAVAILABLE"
+		}
+		// 目标地址被出站策略拒绝（DNS重绑定、重定向到非白名单主机等）
+		if errors.Is(err, httpclient.ErrBlockedDestination) {
+			attempt.ErrorCode = "DESTINATION_BLOCKED"
+			w.logger.Warn("Blocked destination for task %s, partner %s: %v", task.TaskID, task.PartnerID, err)
+		}
 	}
 
 	// 更新尝试记录
 	attempt.Status = core.AttemptStatusSent
 	attempt.HTTPStatusCode = responseCode
 	attempt.LatencyMs = latency.Milliseconds()
+	var redirects []httpclient.Redirect
+	var requestErr *httpclient.RequestError
+	if resp != nil {
+		attempt.ResponseBody, attempt.ResponseHeaders = captureResponse(resp, w.config.Worker.ResponseCaptureBytes, w.config.Worker.CaptureResponseHeaders)
+		w.recordTiming(task, attempt, resp.Timing)
+		redirects = resp.Redirects
+	} else if errors.As(err, &requestErr) {
+		// 发送失败时记录失败前完成的阶段耗时，便于区分DNS、连接、TLS握手等阶段的故障
+		w.recordTiming(task, attempt, requestErr.Timing)
+		// 重定向被拒绝或超过跳数时保留已经过的重定向链
+		redirects = requestErr.Redirects
+	}
+	if len(redirects) > 0 {
+		if data, err := json.Marshal(redactRedirectChain(redirects)); err == nil {
+			attempt.RedirectChain = string(data)
+		}
+	}
+	if resp != nil && len(resp.Redirects) > 0 {
+		w.applyPermanentRedirect(ctx, task, resp.Redirects)
+	}
 
 	// 记录尝试
 	if err := w.store.RecordAttempt(ctx, attempt); err != nil {
@@ -166,6 +277,8 @@ func (w *Worker) processTask(ctx context.Context, task *core.NotificationTask) {
 			w.logger.Error("Failed to update task status to completed for task %s: %v", task.TaskID, err)
 			return
 		}
+		w.releaseTaskSecrets(ctx, task)
+		w.enqueueCallback(ctx, task, core.TaskStatusSucceeded)
 		w.logger.Info("Notification sent successfully for task %s, status code: %d, latency: %dms", task.TaskID, responseCode, attempt.LatencyMs)
 		return
 	}
@@ -186,12 +299,97 @@ func (w *Worker) processTask(ctx context.Context, task *core.NotificationTask) {
 			w.logger.Error("Failed to update task status to dead for task %s: %v", task.TaskID, err)
 			return
 		}
+		w.releaseTaskSecrets(ctx, task)
+		w.enqueueCallback(ctx, task, core.TaskStatusDead)
 		w.logger.Info("Notification failed for task %s after %d attempts, marked as dead", task.TaskID, task.MaxAttempts)
 	}
 }
 
-// sendNotification 发送单个通知
-func (w *Worker) sendNotification(ctx context.Context, task *core.NotificationTask) (bool, int, string, error) {
+// recordTiming 将连接阶段耗时写入尝试记录并上报指标，未发生的阶段和未取得的连接不计入指标
+func (w *Worker) recordTiming(task *core.NotificationTask, attempt *core.NotificationAttempt, timing httpclient.Timing) {
+	attempt.DNSMs = timing.DNS.Milliseconds()
+	attempt.ConnectMs = timing.Connect.Milliseconds()
+	attempt.TLSHandshakeMs = timing.TLSHandshake.Milliseconds()
+	attempt.TTFBMs = timing.TimeToFirstByte.Milliseconds()
+	attempt.TransferMs = timing.Transfer.Milliseconds()
+	attempt.ConnReused = timing.ConnReused
+	attempt.RemoteIP = timing.RemoteIP
+
+	w.metrics.RecordConnectionTiming(task.PartnerID, metrics.ConnectionTiming{
+		DNS:             timing.DNS,
+		Connect:         timing.Connect,
+		TLSHandshake:    timing.TLSHandshake,
+		TimeToFirstByte: timing.TimeToFirstByte,
+		Transfer:        timing.Transfer,
+		ConnReused:      timing.ConnReused,
+		Connected:       timing.Connected,
+	})
+}
+
+// enqueueCallback 任务到达终态后创建状态回调任务，失败只记录日志，不影响任务本身的状态
+func (w *Worker) enqueueCallback(ctx context.Context, task *core.NotificationTask, status core.TaskStatus) {
+	if err := callback.Enqueue(ctx, w.store, task, status, w.config.Worker.MaxAttempts); err != nil {
+		w.logger.Error("Failed to enqueue status callback for task %s: %v", task.TaskID, err)
+	}
+}
+
+// releaseTaskSecrets 任务到达终态后删除创建任务时保存的敏感头密钥，失败只记录日志
+func (w *Worker) releaseTaskSecrets(ctx context.Context, task *core.NotificationTask) {
+	if err := secrets.DeleteTaskSecrets(ctx, w.store, task.PartnerID, task.TaskID); err != nil {
+		w.logger.Error("Failed to delete secrets for task %s: %v", task.TaskID, err)
+	}
+}
+
+// ExpireTasks 将已过期的等待中任务改为expired，删除其敏感头密钥并发送状态回调，由领导者实例定期调用
+func (w *Worker) ExpireTasks(ctx context.Context) {
+	tasks, err := w.store.ExpireTasks(ctx, w.settings.BatchSize)
+	for _, task := range tasks {
+		w.releaseTaskSecrets(ctx, task)
+		w.enqueueCallback(ctx, task, core.TaskStatusExpired)
+		w.logger.Info("Task %s expired at %s before it was delivered", task.TaskID, task.ExpiresAt.Format(time.RFC3339))
+	}
+	if err != nil {
+		w.logger.Error("Failed to expire tasks: %v", err)
+	}
+}
+
+// deferTask 因目标主机并发受限推迟任务
+func (w *Worker) deferTask(ctx context.Context, task *core.NotificationTask, host string) {
+	nextAttemptAt := time.Now().Add(w.settings.DeferDelay)
+	if err := w.store.UpdateTaskStatus(ctx, task.TaskID, core.TaskStatusPending, nextAttemptAt); err != nil {
+		w.logger.Error("Failed to defer task %s: %v", task.TaskID, err)
+		return
+	}
+	w.logger.Debug("Concurrency limit reached for host %s, task %s deferred to %s", host, task.TaskID, nextAttemptAt.Format(time.RFC3339))
+}
+
+// sendNotification 发送单个通知，实际发出的请求快照写入attempt
+func (w *Worker) sendNotification(ctx context.Context, task *core.NotificationTask, attempt *core.NotificationAttempt) (bool, *httpclient.Response, error) {
+	// 请求体保存在blob存储中时，发送前才加载（加载结果不写回任务）
+	if task.BodyRef != "" {
+		body, err := w.store.LoadTaskBody(ctx, task)
+		if err != nil {
+			return false, nil, fmt.Errorf("%w: %v", ErrBodyUnavailable, err)
+		}
+		loaded := *task
+		loaded.Body = body
+		task = &loaded
+	}
+
+	// 任务引用了合作方模板时，按当前模板渲染请求体、请求头和URL（渲染结果不写回任务）
+	if task.TemplateName != "" {
+		rendered, err := w.renderTemplate(ctx, task)
+		if err != nil {
+			return false, nil, err
+		}
+		task = rendered
+	}
+
+	// 派发时按当前策略重新检查目标（策略可能在任务创建后收紧）
+	if err := w.policy.CheckURL(task.PartnerID, task.TargetURL); err != nil {
+		return false, nil, fmt.Errorf("%w: %v", httpclient.ErrBlockedDestination, err)
+	}
+
 	// 解析请求头
 	var headers map[string]string
 	if task.Headers != "" {
@@ -203,30 +401,61 @@ func (w *Worker) sendNotification(ctx context.Context, task *core.NotificationTa
 		headers = make(map[string]string)
 	}
 
-	// 替换敏感头占位符
+	// 替换请求头中的密钥占位符 {{NAME}}，替换过的头在请求快照中脱敏
+	// 找不到密钥时保留占位符
+	secrets := newResolvedSecrets()
 	for key, value := range headers {
-		// 检查是否是敏感头占位符格式 {{HEADER_NAME}}
-		if strings.HasPrefix(value, "{{") && strings.HasSuffix(value, "}}") {
-			headerName := strings.TrimSpace(value[2 : len(value)-2])
-			// 从配置中获取真实的敏感头值
-			if realValue, exists := w.settings.SensitiveHeaders[headerName]; exists {
-				headers[key] = realValue
-				w.logger.Debug("Replaced sensitive header placeholder for task %s: %s", task.TaskID, key)
-			} else {
-				w.logger.Warn("Sensitive header placeholder not found in config for task %s: %s", task.TaskID, headerName)
-				// 如果没有找到真实值，可以考虑移除这个头或者保留占位符
-				// 这里我们选择保留占位符
-			}
+		resolvedValue, err := w.substitute(ctx, task, value, nil, secrets)
+		if err != nil {
+			return false, nil, err
+		}
+		if resolvedValue != value {
+			headers[key] = resolvedValue
+			secrets.headers[http.CanonicalHeaderKey(key)] = true
+			w.logger.Debug("Replaced sensitive header placeholder for task %s: %s", task.TaskID, key)
 		}
 	}
 
-	// 创建HTTP请求
-	resp, err := w.httpClient.Do(ctx, task.HTTPMethod, task.TargetURL, headers, []byte(task.Body))
+	// 替换URL和请求体中的占位符，真实值只存在于本次请求，任务中仍保存占位符
+	resolved := *task
+	var err error
+	if resolved.TargetURL, err = w.substituteURL(ctx, task, task.TargetURL, secrets); err != nil {
+		return false, nil, err
+	}
+	if resolved.Body, err = w.substituteBody(ctx, task, secrets); err != nil {
+		return false, nil, err
+	}
+
+	// 附加身份头，接收方可据此对重试去重
+	w.setIdentityHeaders(task, attempt.AttemptNo, headers)
+
+	// 注入OAuth2访问令牌（令牌仅存在于本次请求的头中，不写入任务）
+	oauthCfg := w.config.Partner(task.PartnerID).OAuth2
+	if oauthCfg != nil {
+		if err := w.injectAccessToken(ctx, task, oauthCfg, headers); err != nil {
+			return false, nil, err
+		}
+	}
+
+	resp, err := w.doSend(ctx, &resolved, headers, secrets, attempt)
 	if err != nil {
-		return false, 0, "", err
+		return false, nil, err
 	}
 
-	// 记录日志（脱敏与截断）
+	// 令牌可能已被接收方提前吊销：刷新令牌后重试一次
+	if resp.StatusCode == 401 && oauthCfg != nil {
+		w.logger.Info("Received 401 for task %s, refreshing OAuth2 token and retrying once", task.TaskID)
+		w.tokens.Invalidate(task.PartnerID)
+		if err := w.injectAccessToken(ctx, task, oauthCfg, headers); err != nil {
+			return false, nil, err
+		}
+		resp, err = w.doSend(ctx, &resolved, headers, secrets, attempt)
+		if err != nil {
+			return false, nil, err
+		}
+	}
+
+	// 记录日志（脱敏与截断，URL和请求体使用替换前的占位符形式）
 	w.logHTTPRequest(task, headers)
 
 	// 根据响应码判断是否成功
@@ -243,7 +472,253 @@ func (w *Worker) sendNotification(ctx context.Context, task *core.NotificationTa
 		success = false
 	}
 
-	return success, resp.StatusCode, string(resp.Body), nil
+	return success, resp, nil
+}
+
+// renderTemplate 加载任务引用的合作方模板并渲染
+func (w *Worker) renderTemplate(ctx context.Context, task *core.NotificationTask) (*core.NotificationTask, error) {
+	tmpl, err := w.store.GetTemplate(ctx, task.PartnerID, task.TemplateName)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl == nil {
+		return nil, fmt.Errorf("%w: template %q not found for partner %s", render.ErrRender, task.TemplateName, task.PartnerID)
+	}
+
+	rendered, err := render.Apply(task, tmpl)
+	if err != nil {
+		w.logger.Warn("Failed to render template %s for task %s: %v", task.TemplateName, task.TaskID, err)
+		return nil, err
+	}
+	return rendered, nil
+}
+
+// applyPermanentRedirect 合作方配置为follow_update时，若重定向链以301/308开头，
+// 将任务目标URL永久更新为最后一个永久重定向的目标
+func (w *Worker) applyPermanentRedirect(ctx context.Context, task *core.NotificationTask, redirects []httpclient.Redirect) {
+	if w.config.Partner(task.PartnerID).Redirect.Mode != config.RedirectModeFollowUpdate {
+		return
+	}
+
+	newURL := ""
+	for _, hop := range redirects {
+		if hop.StatusCode != 301 && hop.StatusCode != 308 {
+			break
+		}
+		newURL = hop.To
+	}
+	if newURL == "" || newURL == task.TargetURL {
+		return
+	}
+	// 重定向目标中包含已脱敏的密钥时无法还原，不更新
+	if strings.Contains(newURL, redactedValue) {
+		w.logger.Warn("Permanent redirect target for task %s contains a secret, target url not updated", task.TaskID)
+		return
+	}
+
+	if err := w.store.UpdateTaskTargetURL(ctx, task.TaskID, newURL); err != nil {
+		w.logger.Error("Failed to update target url for task %s: %v", task.TaskID, err)
+		return
+	}
+	w.logger.Info("Task %s target url permanently redirected to %s", task.TaskID, redactURL(newURL))
+}
+
+// doSend 签名并通过目标协议对应的投递通道发送请求，发送前记录请求快照
+// 错误信息和请求快照中替换进去的密钥均已脱敏
+func (w *Worker) doSend(ctx context.Context, task *core.NotificationTask, headers map[string]string, secrets *resolvedSecrets, attempt *core.NotificationAttempt) (*httpclient.Response, error) {
+	transport, err := w.transportFor(task.TargetURL)
+	if err != nil {
+		return nil, secrets.redactError(err)
+	}
+
+	// 按编码方式得到实际发送的请求体，未指定Content-Type时使用编码方式的默认值
+	body, err := payload.Decode(task.BodyEncoding, task.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 0 && !render.HasHeader(headers, "Content-Type") {
+		headers["Content-Type"] = payload.ContentType(task.BodyEncoding)
+	}
+
+	// 使用合作方签名密钥为请求签名
+	if err := w.signRequest(ctx, task, headers, body); err != nil {
+		return nil, err
+	}
+
+	// 记录将要发送的请求（发送失败时同样保留，便于排查超时等问题），发送后按实际发出的请求更新
+	attempt.RequestSnapshot = snapshotRequest(task.HTTPMethod, task.TargetURL, headers, body, secrets)
+
+	// 创建HTTP请求
+	partner := w.config.Partner(task.PartnerID)
+	redirectCfg := partner.Redirect
+	resp, err := transport.Send(ctx, &httpclient.Request{
+		Method:  task.HTTPMethod,
+		URL:     task.TargetURL,
+		Headers: headers,
+		Body:    body,
+		Profile: task.PartnerID, // 按合作方选择传输层（mTLS证书、私有CA等）
+		Redirect: httpclient.RedirectPolicy{
+			NoFollow: redirectCfg.Mode == config.RedirectModeNone,
+			MaxHops:  redirectCfg.MaxHops,
+		},
+		Timeouts: w.requestTimeouts(task, partner.Timeouts),
+		Compression: httpclient.Compression{
+			Algorithm: partner.Compression.Algorithm,
+			MinSize:   partner.Compression.MinBytes,
+		},
+		// 日志中使用脱敏后的URL，替换进去的密钥不会出现在传输层日志中
+		LogURL: secrets.redact(task.TargetURL),
+	})
+	if err != nil {
+		// 发送失败时已经过的重定向链同样写入尝试记录，其中替换进去的密钥脱敏
+		var requestErr *httpclient.RequestError
+		if errors.As(err, &requestErr) {
+			secrets.redactRedirects(requestErr.Redirects)
+			w.snapshotSent(attempt, task, requestErr.Sent, secrets)
+		}
+		return nil, &deliveryError{err: secrets.redactError(err)}
+	}
+
+	// 重定向链会写入尝试记录，其中替换进去的密钥脱敏
+	secrets.redactRedirects(resp.Redirects)
+	w.snapshotSent(attempt, task, resp.Sent, secrets)
+	return resp, nil
+}
+
+// snapshotSent 用传输层实际发出的请求（压缩后的请求体、415回退后的重发）更新请求快照
+// 邮件等不返回发出请求的投递通道保留发送前的快照
+func (w *Worker) snapshotSent(attempt *core.NotificationAttempt, task *core.NotificationTask, sent httpclient.SentRequest, secrets *resolvedSecrets) {
+	if sent.Headers == nil {
+		return
+	}
+	headers := make(map[string]string, len(sent.Headers))
+	for key := range sent.Headers {
+		headers[key] = sent.Headers.Get(key)
+	}
+	attempt.RequestSnapshot = snapshotRequest(task.HTTPMethod, task.TargetURL, headers, sent.Body, secrets)
+}
+
+// requestTimeouts 合并合作方和任务的超时设置，生效顺序：任务 > 合作方 > 客户端默认值
+func (w *Worker) requestTimeouts(task *core.NotificationTask, partnerTimeouts config.PartnerTimeoutConfig) httpclient.Timeouts {
+	timeouts := msTimeouts(core.TaskTimeouts{
+		ConnectMs:        partnerTimeouts.ConnectMs,
+		TLSHandshakeMs:   partnerTimeouts.TLSHandshakeMs,
+		ResponseHeaderMs: partnerTimeouts.ResponseHeaderMs,
+		TotalMs:          partnerTimeouts.TotalMs,
+	})
+
+	if task.Timeouts != "" {
+		var taskTimeouts core.TaskTimeouts
+		if err := json.Unmarshal([]byte(task.Timeouts), &taskTimeouts); err != nil {
+			w.logger.Warn("Failed to parse timeouts for task %s: %v", task.TaskID, err)
+		} else {
+			timeouts = timeouts.Merge(msTimeouts(taskTimeouts))
+		}
+	}
+
+	return timeouts
+}
+
+// msTimeouts 将毫秒超时设置转换为httpclient.Timeouts
+func msTimeouts(t core.TaskTimeouts) httpclient.Timeouts {
+	return httpclient.Timeouts{
+		Connect:        time.Duration(t.ConnectMs) * time.Millisecond,
+		TLSHandshake:   time.Duration(t.TLSHandshakeMs) * time.Millisecond,
+		ResponseHeader: time.Duration(t.ResponseHeaderMs) * time.Millisecond,
+		Total:          time.Duration(t.TotalMs) * time.Millisecond,
+	}
+}
+
+// injectAccessToken 获取合作方的OAuth2访问令牌并写入Authorization头
+func (w *Worker) injectAccessToken(ctx context.Context, task *core.NotificationTask, oauthCfg *config.PartnerOAuth2Config, headers map[string]string) error {
+	token, err := w.tokens.Token(ctx, task.PartnerID, oauth2.Credentials{
+		TokenURL:     oauthCfg.TokenURL,
+		ClientID:     oauthCfg.ClientID,
+		ClientSecret: oauthCfg.ClientSecret,
+		Scopes:       oauthCfg.Scopes,
+		Audience:     oauthCfg.Audience,
+	})
+	if err != nil {
+		return err
+	}
+
+	setHeader(headers, "Authorization", "Bearer "+token)
+	return nil
+}
+
+// setIdentityHeaders 设置标识本次投递的身份头（任务ID、尝试次数、幂等键、创建时间、事件类型）
+// 同一任务的各次尝试除尝试次数外保持不变，覆盖任务中同名的请求头
+func (w *Worker) setIdentityHeaders(task *core.NotificationTask, attemptNo int, headers map[string]string) {
+	names := w.config.Partner(task.PartnerID).IdentityHeaders
+	values := []struct {
+		name  string
+		value string
+	}{
+		{names.TaskID, task.TaskID},
+		{names.AttemptNo, strconv.Itoa(attemptNo)},
+		{names.IdempotencyKey, task.IdempotencyKey},
+		{names.CreatedAt, task.CreatedAt.UTC().Format(time.RFC3339)},
+		{names.EventType, task.EventType},
+	}
+	for _, header := range values {
+		if header.name == config.DisabledHeader || header.value == "" {
+			continue
+		}
+		setHeader(headers, header.name, header.value)
+	}
+}
+
+// setHeader 设置请求头，并移除仅大小写不同的同名头，避免发送时被随机覆盖
+func setHeader(headers map[string]string, key, value string) {
+	for k := range headers {
+		if k != key && strings.EqualFold(k, key) {
+			delete(headers, k)
+		}
+	}
+	headers[key] = value
+}
+
+// signRequest 按Standard Webhooks规范为请求添加签名头
+// ed25519方案使用服务私钥签名；hmac方案使用合作方所有有效密钥签名，
+// 轮换期间接收方可用新旧任一密钥验证，合作方未配置密钥时不签名
+func (w *Worker) signRequest(ctx context.Context, task *core.NotificationTask, headers map[string]string, body []byte) error {
+	if w.config.Partner(task.PartnerID).SignatureScheme == config.SignatureSchemeEd25519 {
+		timestamp := time.Now()
+		keyID, signature, err := w.keyring.Sign(task.TaskID, timestamp, body)
+		if err != nil {
+			return err
+		}
+		for k, v := range signing.Headers(task.TaskID, timestamp, signature) {
+			setHeader(headers, k, v)
+		}
+		setHeader(headers, signing.HeaderWebhookKeyID, keyID)
+		return nil
+	}
+
+	secrets, err := w.store.GetActiveSigningSecrets(ctx, task.PartnerID)
+	if err != nil {
+		return err
+	}
+	if len(secrets) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		values = append(values, secret.Secret)
+	}
+
+	// webhook-id使用任务ID，重试时保持不变以便接收方去重
+	timestamp := time.Now()
+	signature, err := signing.SignHMAC(task.TaskID, timestamp, body, values)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range signing.Headers(task.TaskID, timestamp, signature) {
+		setHeader(headers, k, v)
+	}
+	return nil
 }
 
 // logHTTPRequest 记录HTTP请求日志（脱敏与截断）
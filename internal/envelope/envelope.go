@@ -0,0 +1,199 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDecrypt 密文无法解密（密钥不匹配或数据被篡改）
+var ErrDecrypt = errors.New("failed to decrypt payload")
+
+// ErrUnknownKey 密文使用的密钥加密密钥未配置
+var ErrUnknownKey = fmt.Errorf("%w: unknown key id", ErrDecrypt)
+
+// ciphertextPrefix 密文格式版本前缀
+const ciphertextPrefix = "v1:"
+
+// dataKeySize 数据密钥长度（AES-256）
+const dataKeySize = 32
+
+// Keyring 密钥加密密钥（KEK）集合，新数据密钥始终由当前密钥包装，旧密钥只用于解包
+type Keyring struct {
+	keys   map[string]cipher.AEAD
+	active string
+}
+
+// DataKey 单行数据使用的数据密钥，KeyID和Wrapped与密文一起保存
+type DataKey struct {
+	// KeyID 包装该数据密钥的密钥加密密钥ID
+	KeyID string
+	// Wrapped 被包装（加密）后的数据密钥
+	Wrapped string
+	aead    cipher.AEAD
+}
+
+// NewKeyring 使用base64编码的32字节密钥创建密钥环，activeID为空且只有一个密钥时使用该密钥
+func NewKeyring(keys map[string]string, activeID string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("at least one encryption key is required")
+	}
+
+	ring := &Keyring{keys: make(map[string]cipher.AEAD, len(keys)), active: activeID}
+	for id, encoded := range keys {
+		if id == "" || len(id) > 64 {
+			return nil, fmt.Errorf("encryption key id must be 1-64 characters")
+		}
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("encryption key %s must be base64 encoded: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key %s must be 32 bytes, got %d", id, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		ring.keys[id] = aead
+	}
+
+	if ring.active == "" {
+		if len(keys) > 1 {
+			return nil, fmt.Errorf("active encryption key id is required when more than one key is configured")
+		}
+		for id := range keys {
+			ring.active = id
+		}
+	}
+	if _, ok := ring.keys[ring.active]; !ok {
+		return nil, fmt.Errorf("active encryption key %s is not configured", ring.active)
+	}
+	return ring, nil
+}
+
+// ActiveKeyID 返回当前用于包装数据密钥的密钥ID
+func (r *Keyring) ActiveKeyID() string {
+	return r.active
+}
+
+// NewDataKey 生成新的数据密钥并用当前密钥包装，aad绑定数据密钥的归属（如任务ID）
+func (r *Keyring) NewDataKey(aad []byte) (*DataKey, error) {
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrapped, err := seal(r.keys[r.active], key, aad)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{KeyID: r.active, Wrapped: wrapped, aead: aead}, nil
+}
+
+// OpenDataKey 解包数据密钥
+func (r *Keyring) OpenDataKey(keyID, wrapped string, aad []byte) (*DataKey, error) {
+	key, err := r.unwrap(keyID, wrapped, aad)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{KeyID: keyID, Wrapped: wrapped, aead: aead}, nil
+}
+
+// Rewrap 用当前密钥重新包装数据密钥，数据本身的密文不变
+func (r *Keyring) Rewrap(keyID, wrapped string, aad []byte) (*DataKey, error) {
+	key, err := r.unwrap(keyID, wrapped, aad)
+	if err != nil {
+		return nil, err
+	}
+	rewrapped, err := seal(r.keys[r.active], key, aad)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &DataKey{KeyID: r.active, Wrapped: rewrapped, aead: aead}, nil
+}
+
+// unwrap 使用指定密钥解包数据密钥
+func (r *Keyring) unwrap(keyID, wrapped string, aad []byte) ([]byte, error) {
+	kek, ok := r.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	key, err := open(kek, wrapped, aad)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("%w: invalid data key length", ErrDecrypt)
+	}
+	return key, nil
+}
+
+// Seal 使用数据密钥加密明文，aad绑定密文的归属（如任务ID和列名），解密时必须一致
+func (k *DataKey) Seal(plaintext, aad []byte) (string, error) {
+	return seal(k.aead, plaintext, aad)
+}
+
+// Open 使用数据密钥解密Seal生成的密文
+func (k *DataKey) Open(ciphertext string, aad []byte) ([]byte, error) {
+	return open(k.aead, ciphertext, aad)
+}
+
+// newAEAD 创建AES-256-GCM加解密器
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+	return aead, nil
+}
+
+// seal 加密并编码为 v1:base64(nonce|密文)
+func seal(aead cipher.AEAD, plaintext, aad []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, aad)
+	return ciphertextPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open 解密seal生成的密文
+func open(aead cipher.AEAD, ciphertext string, aad []byte) ([]byte, error) {
+	if !strings.HasPrefix(ciphertext, ciphertextPrefix) {
+		return nil, fmt.Errorf("%w: unknown ciphertext format", ErrDecrypt)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, ciphertextPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrDecrypt)
+	}
+
+	nonce, data := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, data, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return plaintext, nil
+}
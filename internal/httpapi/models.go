@@ -2,6 +2,9 @@ package httpapi
 
 import (
 	"encoding/json"
+	"time"
+
+	"api-notify/internal/core"
 )
 
 // CreateNotificationRequest 创建通知请求
@@ -10,10 +13,24 @@ type CreateNotificationRequest struct {
 	Method         string                 `json:"method" validate:"omitempty,oneof=GET POST PUT DELETE"`
 	Headers        map[string]string      `json:"headers"`
 	Body           json.RawMessage        `json:"body"`
+	// BodyEncoding 请求体编码方式：json（默认）、form、text、base64-binary
+	BodyEncoding   string                 `json:"body_encoding"`
 	IdempotencyKey string                 `json:"idempotency_key"`
 	PartnerID      string                 `json:"partner_id" validate:"required"`
 	Priority       int                    `json:"priority"`
 	SuccessCondition string               `json:"success_condition"`
+	// EventType 事件类型，投递时通过身份头发送给接收方
+	EventType      string                 `json:"event_type"`
+	// CallbackURL 任务到达终态（succeeded/dead/cancelled/expired）后接收签名状态报告的地址
+	CallbackURL    string                 `json:"callback_url"`
+	// ExpiresAt 过期时间（RFC3339），到期仍未投递成功的任务不再重试，状态改为expired
+	ExpiresAt      *time.Time             `json:"expires_at,omitempty"`
+	// Timeouts 覆盖合作方和全局的超时设置（毫秒）
+	Timeouts       *core.TaskTimeouts     `json:"timeouts,omitempty"`
+	// TemplateName 合作方模板名称，派发时用TemplateData渲染请求体、请求头和URL
+	TemplateName   string                 `json:"template_name"`
+	// TemplateData 模板数据（JSON对象）
+	TemplateData   json.RawMessage        `json:"template_data"`
 }
 
 // CreateNotificationResponse 创建通知响应
@@ -29,6 +46,11 @@ type GetNotificationResponse struct {
 	TargetURL          string                    `json:"target_url"`
 	Method             string                    `json:"method"`
 	Status             string                    `json:"status"`
+	EventType          string                    `json:"event_type,omitempty"`
+	CallbackURL        string                    `json:"callback_url,omitempty"`
+	ExpiresAt          string                    `json:"expires_at,omitempty"`
+	TemplateName       string                    `json:"template_name,omitempty"`
+	BodyEncoding       string                    `json:"body_encoding,omitempty"`
 	NextAttemptAt      string                    `json:"next_attempt_at,omitempty"`
 	MaxAttempts        int                       `json:"max_attempts"`
 	AttemptCount       int                       `json:"attempt_count"`
@@ -44,9 +66,36 @@ type LastAttemptSummary struct {
 	ErrorCode      string `json:"error_code"`
 	ErrorMessage   string `json:"error_message"`
 	LatencyMs      int64  `json:"latency_ms"`
+	// RedirectChain 本次尝试经过的重定向链
+	RedirectChain json.RawMessage `json:"redirect_chain,omitempty"`
+	// ResponseBody 截断并脱敏后的响应体
+	ResponseBody string `json:"response_body,omitempty"`
+	// ResponseHeaders 选定的响应头
+	ResponseHeaders json.RawMessage `json:"response_headers,omitempty"`
+	// RequestSnapshot 实际发送的请求（脱敏，请求体仅含摘要和大小）
+	RequestSnapshot json.RawMessage `json:"request_snapshot,omitempty"`
+	// Timing 连接阶段耗时，请求未收到响应时为空
+	Timing         *AttemptTiming `json:"timing,omitempty"`
 	CreatedAt      string `json:"created_at"`
 }
 
+// AttemptTiming 尝试的连接阶段耗时（毫秒）
+type AttemptTiming struct {
+	DNSMs          int64  `json:"dns_ms"`
+	ConnectMs      int64  `json:"connect_ms"`
+	TLSHandshakeMs int64  `json:"tls_handshake_ms"`
+	TTFBMs         int64  `json:"ttfb_ms"`
+	TransferMs     int64  `json:"transfer_ms"`
+	ConnReused     bool   `json:"conn_reused"`
+	RemoteIP       string `json:"remote_ip"`
+}
+
+// ListAttemptsResponse 尝试记录列表响应
+type ListAttemptsResponse struct {
+	TaskID   string               `json:"task_id"`
+	Attempts []LastAttemptSummary `json:"attempts"`
+}
+
 // ErrorResponse 错误响应
 type ErrorResponse struct {
 	Code    int    `json:"code"`
@@ -57,4 +106,84 @@ type ErrorResponse struct {
 type CancelNotificationResponse struct {
 	TaskID string `json:"task_id"`
 	Status string `json:"status"`
-}
\ No newline at end of file
+}
+// CreateSigningSecretRequest 创建/轮换签名密钥请求
+type CreateSigningSecretRequest struct {
+	// RotateGraceSeconds 旧密钥在轮换后继续参与签名的秒数，0表示使用默认宽限期，负数表示旧密钥立即失效
+	RotateGraceSeconds int `json:"rotate_grace_seconds"`
+}
+
+// SigningSecretResponse 签名密钥响应
+type SigningSecretResponse struct {
+	SecretID  string `json:"secret_id"`
+	PartnerID string `json:"partner_id"`
+	Secret    string `json:"secret,omitempty"` // 仅在创建时返回
+	Status    string `json:"status"`
+	ExpiresAt string `json:"expires_at,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ListSigningSecretsResponse 签名密钥列表响应
+type ListSigningSecretsResponse struct {
+	Secrets []SigningSecretResponse `json:"secrets"`
+}
+
+// SaveTemplateRequest 创建或替换模板请求，模板使用Go text/template语法
+type SaveTemplateRequest struct {
+	// Body 请求体模板
+	Body string `json:"body"`
+	// Headers 请求头模板，键为请求头名称
+	Headers map[string]string `json:"headers"`
+	// URL 路径和查询参数模板，如 /orders/{{urlPathEscape .order_id}}?v=2
+	URL string `json:"url"`
+}
+
+// TemplateResponse 模板响应
+type TemplateResponse struct {
+	PartnerID string            `json:"partner_id"`
+	Name      string            `json:"name"`
+	Body      string            `json:"body,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	URL       string            `json:"url,omitempty"`
+	CreatedAt string            `json:"created_at,omitempty"`
+	UpdatedAt string            `json:"updated_at,omitempty"`
+}
+
+// ListTemplatesResponse 模板列表响应
+type ListTemplatesResponse struct {
+	Templates []TemplateResponse `json:"templates"`
+}
+
+// PreviewTemplateRequest 模板渲染预览请求
+type PreviewTemplateRequest struct {
+	Data      json.RawMessage   `json:"data"`
+	TargetURL    string            `json:"target_url"`
+	Headers      map[string]string `json:"headers"`
+	BodyEncoding string            `json:"body_encoding"`
+}
+
+// PreviewTemplateResponse 模板渲染预览响应
+type PreviewTemplateResponse struct {
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	URL     string            `json:"url,omitempty"`
+}
+
+// PutPartnerSecretRequest 保存合作方密钥请求
+type PutPartnerSecretRequest struct {
+	Value string `json:"value"`
+}
+
+// PartnerSecretResponse 合作方密钥响应（不含密钥值）
+type PartnerSecretResponse struct {
+	PartnerID   string `json:"partner_id"`
+	Name        string `json:"name"`
+	Placeholder string `json:"placeholder"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	UpdatedAt   string `json:"updated_at,omitempty"`
+}
+
+// ListPartnerSecretsResponse 合作方密钥列表响应
+type ListPartnerSecretsResponse struct {
+	Secrets []PartnerSecretResponse `json:"secrets"`
+}
@@ -0,0 +1,150 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"api-notify/internal/core"
+	"api-notify/internal/signing"
+)
+
+// handlePartner 处理合作方相关请求
+// POST /v1/partners/{partner_id}/signing-secrets                    创建或轮换签名密钥
+// GET  /v1/partners/{partner_id}/signing-secrets                    列出签名密钥
+// POST /v1/partners/{partner_id}/signing-secrets/{secret_id}/revoke 吊销签名密钥
+// 模板和密钥库相关路由见handleTemplates、handlePartnerSecrets
+func (r *Router) handlePartner(w http.ResponseWriter, req *http.Request) {
+	parts := splitPath(req.URL.Path)
+	if len(parts) < 4 {
+		r.writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	partnerID := parts[2]
+
+	switch parts[3] {
+	case "signing-secrets":
+		r.handleSigningSecrets(w, req, partnerID, parts)
+	case "templates":
+		r.handleTemplates(w, req, partnerID, parts)
+	case "secrets":
+		r.handlePartnerSecrets(w, req, partnerID, parts)
+	default:
+		r.writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// handleSigningSecrets 分发签名密钥请求
+func (r *Router) handleSigningSecrets(w http.ResponseWriter, req *http.Request, partnerID string, parts []string) {
+	switch {
+	case len(parts) == 4 && req.Method == http.MethodPost:
+		r.handleCreateSigningSecret(w, req, partnerID)
+	case len(parts) == 4 && req.Method == http.MethodGet:
+		r.handleListSigningSecrets(w, req, partnerID)
+	case len(parts) == 6 && parts[5] == "revoke" && req.Method == http.MethodPost:
+		r.handleRevokeSigningSecret(w, req, partnerID, parts[4])
+	default:
+		r.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleCreateSigningSecret 创建签名密钥；合作方已有有效密钥时视为轮换，旧密钥在宽限期后失效
+func (r *Router) handleCreateSigningSecret(w http.ResponseWriter, req *http.Request, partnerID string) {
+	var reqBody CreateSigningSecretRequest
+	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil && err != io.EOF {
+		r.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	secretValue, err := signing.GenerateSecret()
+	if err != nil {
+		r.logger.Error("Failed to generate signing secret: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to create signing secret")
+		return
+	}
+
+	now := time.Now()
+	grace := r.config.Security.SigningSecretRotationGrace
+	if reqBody.RotateGraceSeconds > 0 {
+		grace = time.Duration(reqBody.RotateGraceSeconds) * time.Second
+	} else if reqBody.RotateGraceSeconds < 0 {
+		grace = 0
+	}
+	rotateAt := now.Add(grace)
+
+	secret := &core.SigningSecret{
+		SecretID:  fmt.Sprintf("whsk_%d_%s", now.UnixNano(), r.generateRandomString(8)),
+		PartnerID: partnerID,
+		Secret:    secretValue,
+		Status:    core.SigningSecretStatusActive,
+		CreatedAt: now,
+	}
+
+	if err := r.store.CreateSigningSecret(req.Context(), secret, &rotateAt); err != nil {
+		r.logger.Error("Failed to create signing secret: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to create signing secret")
+		return
+	}
+
+	r.logger.Info("Signing secret %s created for partner %s", secret.SecretID, partnerID)
+
+	resp := toSigningSecretResponse(secret)
+	resp.Secret = secret.Secret
+	r.writeJSON(w, http.StatusCreated, resp)
+}
+
+// handleListSigningSecrets 列出合作方的签名密钥（不返回密钥值）
+func (r *Router) handleListSigningSecrets(w http.ResponseWriter, req *http.Request, partnerID string) {
+	secrets, err := r.store.ListSigningSecrets(req.Context(), partnerID)
+	if err != nil {
+		r.logger.Error("Failed to list signing secrets: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to list signing secrets")
+		return
+	}
+
+	resp := ListSigningSecretsResponse{Secrets: make([]SigningSecretResponse, 0, len(secrets))}
+	for _, secret := range secrets {
+		resp.Secrets = append(resp.Secrets, toSigningSecretResponse(secret))
+	}
+
+	r.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleRevokeSigningSecret 立即吊销签名密钥
+func (r *Router) handleRevokeSigningSecret(w http.ResponseWriter, req *http.Request, partnerID, secretID string) {
+	found, err := r.store.RevokeSigningSecret(req.Context(), partnerID, secretID)
+	if err != nil {
+		r.logger.Error("Failed to revoke signing secret: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to revoke signing secret")
+		return
+	}
+
+	if !found {
+		r.writeError(w, http.StatusNotFound, "Signing secret not found")
+		return
+	}
+
+	r.logger.Info("Signing secret %s revoked for partner %s", secretID, partnerID)
+
+	r.writeJSON(w, http.StatusOK, SigningSecretResponse{
+		SecretID:  secretID,
+		PartnerID: partnerID,
+		Status:    string(core.SigningSecretStatusRevoked),
+	})
+}
+
+// toSigningSecretResponse 转换签名密钥为响应（不含密钥值）
+func toSigningSecretResponse(secret *core.SigningSecret) SigningSecretResponse {
+	resp := SigningSecretResponse{
+		SecretID:  secret.SecretID,
+		PartnerID: secret.PartnerID,
+		Status:    string(secret.Status),
+		CreatedAt: secret.CreatedAt.Format(time.RFC3339),
+	}
+	if secret.ExpiresAt != nil {
+		resp.ExpiresAt = secret.ExpiresAt.Format(time.RFC3339)
+	}
+	return resp
+}
@@ -1,16 +1,21 @@
 package httpapi
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net"
 	"net/http"
-	"net/url"
 	"strings"
 	"time"
 
+	"api-notify/internal/callback"
 	"api-notify/internal/config"
 	"api-notify/internal/core"
+	"api-notify/internal/payload"
+	"api-notify/internal/secrets"
+	"api-notify/internal/security"
+	"api-notify/internal/signing"
 	"api-notify/internal/store"
 	"api-notify/pkg/logging"
 )
@@ -21,15 +26,24 @@ type Router struct {
 	store  *store.Store
 	logger *logging.Logger
 	config *config.Config
+	// keyring Ed25519签名密钥环，公钥通过JWKS端点发布
+	keyring *signing.Ed25519Keyring
+	// policy 出站目标策略
+	policy *security.Policy
+	// secrets 合作方密钥库，保存请求中敏感头的真实值
+	secrets *secrets.PartnerSecrets
 }
 
 // NewRouter 创建一个新的路由器
-func NewRouter(store *store.Store, logger *logging.Logger, config *config.Config) *Router {
+func NewRouter(store *store.Store, logger *logging.Logger, config *config.Config, keyring *signing.Ed25519Keyring, policy *security.Policy, partnerSecrets *secrets.PartnerSecrets) *Router {
 	router := &Router{
-		mux:    http.NewServeMux(),
-		store:  store,
-		logger: logger,
-		config: config,
+		mux:     http.NewServeMux(),
+		store:   store,
+		logger:  logger,
+		config:  config,
+		keyring: keyring,
+		policy:  policy,
+		secrets: partnerSecrets,
 	}
 
 	// 注册路由
@@ -49,6 +63,10 @@ func (r *Router) registerRoutes() {
 	r.mux.HandleFunc("/v1/notify", r.handleCreateNotification)
 	// 获取通知状态
 	r.mux.HandleFunc("/v1/notify/", r.handleNotification)
+	// 合作方签名密钥、模板和密钥库管理
+	r.mux.HandleFunc("/v1/partners/", r.handlePartner)
+	// Ed25519签名公钥
+	r.mux.HandleFunc("/.well-known/jwks.json", r.handleJWKS)
 }
 
 // handleCreateNotification 处理创建通知请求
@@ -71,9 +89,48 @@ func (r *Router) handleCreateNotification(w http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	// 检查目标URL是否在白名单域名内
-	if !r.isURLInWhitelist(reqBody.TargetURL) {
-		r.writeError(w, http.StatusForbidden, "Target URL is not in whitelist")
+	// 检查目标URL是否符合出站策略
+	if !r.isURLAllowed(reqBody.PartnerID, reqBody.TargetURL) {
+		r.writeError(w, http.StatusForbidden, "Target URL is not allowed")
+		return
+	}
+
+	// 回调地址同样需要符合出站策略
+	if reqBody.CallbackURL != "" && !r.isURLAllowed(reqBody.PartnerID, reqBody.CallbackURL) {
+		r.writeError(w, http.StatusForbidden, "Callback URL is not allowed")
+		return
+	}
+
+	if len(reqBody.EventType) > maxEventTypeLength {
+		r.writeError(w, http.StatusBadRequest, fmt.Sprintf("event_type must be at most %d characters", maxEventTypeLength))
+		return
+	}
+
+	if reqBody.ExpiresAt != nil && !reqBody.ExpiresAt.After(time.Now()) {
+		r.writeError(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	if len(reqBody.TemplateData) > 0 && reqBody.TemplateName == "" {
+		r.writeError(w, http.StatusBadRequest, "template_data requires template_name")
+		return
+	}
+
+	// 按编码方式校验并转换请求体
+	if !payload.ValidEncoding(reqBody.BodyEncoding) {
+		r.writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported body_encoding %q", reqBody.BodyEncoding))
+		return
+	}
+	body, err := payload.Normalize(reqBody.BodyEncoding, reqBody.Body)
+	if err != nil {
+		r.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 校验任务级超时设置
+	timeouts, err := encodeTimeouts(reqBody.Timeouts)
+	if err != nil {
+		r.writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -113,14 +170,28 @@ func (r *Router) handleCreateNotification(w http.ResponseWriter, req *http.Reque
 	// 生成任务ID
 	taskID := fmt.Sprintf("task_%d_%s", time.Now().UnixNano(), r.generateRandomString(8))
 
+	// 敏感头的真实值保存到合作方密钥库（按任务命名），任务中只保存占位符
+	headers, err := r.encodeHeaders(req.Context(), reqBody.PartnerID, taskID, reqBody.Headers)
+	if err != nil {
+		r.deleteTaskSecrets(req.Context(), reqBody.PartnerID, taskID)
+		if errors.Is(err, secrets.ErrNoMasterKey) {
+			r.writeError(w, http.StatusBadRequest, "Sensitive header values cannot be stored: secrets master key is not configured")
+			return
+		}
+		r.logger.Error("Failed to store sensitive headers: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to create notification")
+		return
+	}
+
 	// 创建任务
 	task := &core.NotificationTask{
 		TaskID:             taskID,
 		PartnerID:          reqBody.PartnerID,
 		TargetURL:          reqBody.TargetURL,
 		HTTPMethod:         httpMethod,
-		Headers:            r.encodeHeaders(reqBody.Headers),
-		Body:               string(reqBody.Body),
+		Headers:            headers,
+		Body:               body,
+		BodyEncoding:       reqBody.BodyEncoding,
 		IdempotencyKey:     idempotencyKey,
 		Priority:           reqBody.Priority,
 		Status:             core.TaskStatusPending,
@@ -128,10 +199,26 @@ func (r *Router) handleCreateNotification(w http.ResponseWriter, req *http.Reque
 		MaxAttempts:        maxAttempts,
 		AttemptCount:       0,
 		SuccessCondition:   reqBody.SuccessCondition,
+		Timeouts:           timeouts,
+		EventType:          reqBody.EventType,
+		CallbackURL:        reqBody.CallbackURL,
+		TemplateName:       reqBody.TemplateName,
+		TemplateData:       string(reqBody.TemplateData),
+		ExpiresAt:          reqBody.ExpiresAt,
+	}
+
+	// 引用模板时在创建前试渲染一次，模板不存在或数据不匹配时直接拒绝
+	if task.TemplateName != "" {
+		if status, err := r.validateTemplate(req.Context(), task); err != nil {
+			r.deleteTaskSecrets(req.Context(), task.PartnerID, taskID)
+			r.writeError(w, status, err.Error())
+			return
+		}
 	}
 
 	// 保存任务到数据库
 	if err := r.store.CreateTask(req.Context(), task); err != nil {
+		r.deleteTaskSecrets(req.Context(), task.PartnerID, taskID)
 		r.logger.Error("Failed to create task: %v", err)
 		r.writeError(w, http.StatusInternalServerError, "Failed to create notification")
 		return
@@ -144,6 +231,17 @@ func (r *Router) handleCreateNotification(w http.ResponseWriter, req *http.Reque
 	})
 }
 
+// handleJWKS 发布Ed25519签名公钥，包含轮换期间重叠的所有密钥
+func (r *Router) handleJWKS(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		r.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	r.writeJSON(w, http.StatusOK, r.keyring.JWKS())
+}
+
 // handleNotification 处理获取和取消通知请求
 func (r *Router) handleNotification(w http.ResponseWriter, req *http.Request) {
 	// 解析任务ID
@@ -158,6 +256,9 @@ func (r *Router) handleNotification(w http.ResponseWriter, req *http.Request) {
 	case req.Method == http.MethodGet && action == "":
 		// 获取通知状态
 		r.handleGetNotification(w, req, taskID)
+	case req.Method == http.MethodGet && action == "attempts":
+		// 获取所有尝试记录（含响应详情）
+		r.handleListAttempts(w, req, taskID)
 	case req.Method == http.MethodPost && action == "cancel":
 		// 取消通知
 		r.handleCancelNotification(w, req, taskID)
@@ -196,12 +297,20 @@ func (r *Router) handleGetNotification(w http.ResponseWriter, req *http.Request,
 		TargetURL:      task.TargetURL,
 		Method:         task.HTTPMethod,
 		Status:         string(task.Status),
+		EventType:      task.EventType,
+		CallbackURL:    task.CallbackURL,
+		TemplateName:   task.TemplateName,
+		BodyEncoding:   task.BodyEncoding,
 		MaxAttempts:    task.MaxAttempts,
 		AttemptCount:   len(attempts),
 		CreatedAt:      task.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:      task.UpdatedAt.Format(time.RFC3339),
 	}
 
+	if task.ExpiresAt != nil {
+		resp.ExpiresAt = task.ExpiresAt.Format(time.RFC3339)
+	}
+
 	// 设置下次尝试时间（仅当任务处于非终态时）
 	if task.Status == core.TaskStatusPending || task.Status == core.TaskStatusRunning {
 		resp.NextAttemptAt = task.NextAttemptAt.Format(time.RFC3339)
@@ -211,21 +320,81 @@ func (r *Router) handleGetNotification(w http.ResponseWriter, req *http.Request,
 	if len(attempts) > 0 {
 		// 获取最后一次尝试记录
 		lastAttempt := attempts[len(attempts)-1]
-		
-		resp.LastAttemptSummary = &LastAttemptSummary{
-			AttemptNo:      lastAttempt.AttemptNo,
-			HTTPStatusCode: lastAttempt.HTTPStatusCode,
-			ErrorCode:      lastAttempt.ErrorCode,
-			ErrorMessage:   lastAttempt.ErrorMessage,
-			LatencyMs:      lastAttempt.LatencyMs,
-			CreatedAt:      lastAttempt.CreatedAt.Format(time.RFC3339),
-		}
+		summary := toAttemptSummary(lastAttempt)
+		resp.LastAttemptSummary = &summary
 	}
 
 	// 返回响应
 	r.writeJSON(w, http.StatusOK, resp)
 }
 
+// handleListAttempts 处理获取任务所有尝试记录请求，用于排查合作方拒收原因
+func (r *Router) handleListAttempts(w http.ResponseWriter, req *http.Request, taskID string) {
+	task, err := r.store.GetTaskByTaskID(req.Context(), taskID)
+	if err != nil {
+		r.logger.Error("Failed to get task: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to get attempts")
+		return
+	}
+
+	if task == nil {
+		r.writeError(w, http.StatusNotFound, "Notification not found")
+		return
+	}
+
+	attempts, err := r.store.GetAttemptsByTaskID(req.Context(), taskID)
+	if err != nil {
+		r.logger.Error("Failed to get attempts: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to get attempts")
+		return
+	}
+
+	resp := ListAttemptsResponse{
+		TaskID:   taskID,
+		Attempts: make([]LastAttemptSummary, 0, len(attempts)),
+	}
+	for _, attempt := range attempts {
+		resp.Attempts = append(resp.Attempts, toAttemptSummary(attempt))
+	}
+
+	r.writeJSON(w, http.StatusOK, resp)
+}
+
+// toAttemptSummary 转换尝试记录为响应
+func toAttemptSummary(attempt *core.NotificationAttempt) LastAttemptSummary {
+	summary := LastAttemptSummary{
+		AttemptNo:      attempt.AttemptNo,
+		HTTPStatusCode: attempt.HTTPStatusCode,
+		ErrorCode:      attempt.ErrorCode,
+		ErrorMessage:   attempt.ErrorMessage,
+		LatencyMs:      attempt.LatencyMs,
+		ResponseBody:   attempt.ResponseBody,
+		CreatedAt:      attempt.CreatedAt.Format(time.RFC3339),
+	}
+	if attempt.RedirectChain != "" {
+		summary.RedirectChain = json.RawMessage(attempt.RedirectChain)
+	}
+	if attempt.ResponseHeaders != "" {
+		summary.ResponseHeaders = json.RawMessage(attempt.ResponseHeaders)
+	}
+	if attempt.RequestSnapshot != "" {
+		summary.RequestSnapshot = json.RawMessage(attempt.RequestSnapshot)
+	}
+	// 发送失败的尝试可能只完成了DNS解析或建立连接等部分阶段
+	if attempt.RemoteIP != "" || attempt.DNSMs > 0 || attempt.ConnectMs > 0 || attempt.TLSHandshakeMs > 0 {
+		summary.Timing = &AttemptTiming{
+			DNSMs:          attempt.DNSMs,
+			ConnectMs:      attempt.ConnectMs,
+			TLSHandshakeMs: attempt.TLSHandshakeMs,
+			TTFBMs:         attempt.TTFBMs,
+			TransferMs:     attempt.TransferMs,
+			ConnReused:     attempt.ConnReused,
+			RemoteIP:       attempt.RemoteIP,
+		}
+	}
+	return summary
+}
+
 // handleCancelNotification 处理取消通知请求
 func (r *Router) handleCancelNotification(w http.ResponseWriter, req *http.Request, taskID string) {
 	// 查询任务
@@ -247,17 +416,25 @@ func (r *Router) handleCancelNotification(w http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	// 更新任务状态为dead
-	if err := r.store.UpdateTaskStatus(req.Context(), taskID, core.TaskStatusDead, time.Now()); err != nil {
+	// 更新任务状态为cancelled
+	if err := r.store.UpdateTaskStatus(req.Context(), taskID, core.TaskStatusCancelled, time.Now()); err != nil {
 		r.logger.Error("Failed to cancel task: %v", err)
 		r.writeError(w, http.StatusInternalServerError, "Failed to cancel notification")
 		return
 	}
 
+	// 任务不再派发，删除其敏感头密钥
+	r.deleteTaskSecrets(req.Context(), task.PartnerID, taskID)
+
+	// 通知生产方任务已取消
+	if err := callback.Enqueue(req.Context(), r.store, task, core.TaskStatusCancelled, r.config.Worker.MaxAttempts); err != nil {
+		r.logger.Error("Failed to enqueue status callback for task %s: %v", taskID, err)
+	}
+
 	// 返回响应
 	r.writeJSON(w, http.StatusOK, CancelNotificationResponse{
 		TaskID: taskID,
-		Status: string(core.TaskStatusDead),
+		Status: string(core.TaskStatusCancelled),
 	})
 }
 
@@ -291,25 +468,58 @@ func (r *Router) writeError(w http.ResponseWriter, status int, message string) {
 	})
 }
 
+// maxEventTypeLength 事件类型的最大长度
+const maxEventTypeLength = 128
+
+// maxTimeoutMs 任务可设置的最大超时时间（毫秒），需小于遗留任务回收时间
+const maxTimeoutMs = 120000
+
+// encodeTimeouts 校验任务级超时设置并编码为JSON字符串，未设置时返回空字符串
+func encodeTimeouts(timeouts *core.TaskTimeouts) (string, error) {
+	if timeouts == nil {
+		return "", nil
+	}
+
+	fields := map[string]int{
+		"connect_ms":         timeouts.ConnectMs,
+		"tls_handshake_ms":   timeouts.TLSHandshakeMs,
+		"response_header_ms": timeouts.ResponseHeaderMs,
+		"total_ms":           timeouts.TotalMs,
+	}
+	for name, value := range fields {
+		if value < 0 || value > maxTimeoutMs {
+			return "", fmt.Errorf("timeouts.%s must be between 0 and %d", name, maxTimeoutMs)
+		}
+	}
+
+	if *timeouts == (core.TaskTimeouts{}) {
+		return "", nil
+	}
+
+	data, err := json.Marshal(timeouts)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode timeouts: %w", err)
+	}
+	return string(data), nil
+}
+
 // encodeHeaders 将headers编码为JSON字符串，并替换敏感头为占位符
-func (r *Router) encodeHeaders(headers map[string]string) string {
+// 敏感头的明文值加密保存到该合作方的密钥库，以任务ID和头名称命名（如task_1_ab12_AUTHORIZATION），
+// 只被该任务引用，任务到达终态后删除；已经引用占位符的值原样保存
+func (r *Router) encodeHeaders(ctx context.Context, partnerID, taskID string, headers map[string]string) (string, error) {
 	if headers == nil {
-		return ""
+		return "", nil
 	}
 
 	// 替换敏感头为占位符
 	sanitizedHeaders := make(map[string]string)
 	for k, v := range headers {
-		// 检查是否为敏感头
-		if isSensitiveHeader(k) {
-			// 生成占位符
-			placeholder := fmt.Sprintf("{{%s}}", strings.ToUpper(strings.ReplaceAll(k, "-", "_")))
-			sanitizedHeaders[k] = placeholder
-			// 保存占位符映射到配置（仅在开发环境，生产环境应该从KMS获取）
-			if r.config.Security.SensitiveHeaders == nil {
-				r.config.Security.SensitiveHeaders = make(map[string]string)
+		if isSensitiveHeader(k) && !strings.Contains(v, "{{") {
+			name := secrets.TaskSecretName(taskID, k)
+			if err := r.secrets.Put(ctx, partnerID, name, v); err != nil {
+				return "", err
 			}
-			r.config.Security.SensitiveHeaders[placeholder] = v
+			sanitizedHeaders[k] = fmt.Sprintf("{{%s}}", name)
 		} else {
 			sanitizedHeaders[k] = v
 		}
@@ -318,10 +528,17 @@ func (r *Router) encodeHeaders(headers map[string]string) string {
 	data, err := json.Marshal(sanitizedHeaders)
 	if err != nil {
 		r.logger.Error("Failed to encode headers: %v", err)
-		return ""
+		return "", nil
 	}
 
-	return string(data)
+	return string(data), nil
+}
+
+// deleteTaskSecrets 删除任务的敏感头密钥，失败只记录日志
+func (r *Router) deleteTaskSecrets(ctx context.Context, partnerID, taskID string) {
+	if err := secrets.DeleteTaskSecrets(ctx, r.store, partnerID, taskID); err != nil {
+		r.logger.Error("Failed to delete task secrets: %v", err)
+	}
 }
 
 // isSensitiveHeader 检查是否为敏感头
@@ -377,62 +594,11 @@ func (r *Router) generateRandomString(length int) string {
 	return string(result)
 }
 
-// isURLInWhitelist 检查目标URL是否在白名单域名内，防止SSRF攻击
-func (r *Router) isURLInWhitelist(targetURL string) bool {
-	allowedDomains := r.config.Security.AllowedDomains
-
-	if len(allowedDomains) == 0 || (len(allowedDomains) == 1 && allowedDomains[0] == "*") {
-		return true
-	}
-
-	// 解析URL
-	parsedURL, err := url.Parse(targetURL)
-	if err != nil {
-		r.logger.Error("Failed to parse URL %s: %v", targetURL, err)
+// isURLAllowed 检查合作方的目标URL是否符合出站策略，防止SSRF攻击
+func (r *Router) isURLAllowed(partnerID, targetURL string) bool {
+	if err := r.policy.CheckURL(partnerID, targetURL); err != nil {
+		r.logger.Warn("Target URL rejected: %v", err)
 		return false
 	}
-
-	// 获取主机名
-	host := parsedURL.Host
-	// 如果有端口，去掉端口
-	if idx := strings.Index(host, ":"); idx != -1 {
-		host = host[:idx]
-	}
-
-	// 检查是否为内网/环回地址
-	if ip := net.ParseIP(host); ip != nil {
-		// 检查是否为环回地址
-		if ip.IsLoopback() {
-			r.logger.Warn("Loopback address rejected: %s", host)
-			return false
-		}
-		// 检查是否为内网地址
-		if ip.IsPrivate() {
-			r.logger.Warn("Private address rejected: %s", host)
-			return false
-		}
-		// 检查是否为IPv4/IPv6保留地址
-		if ip.IsUnspecified() || ip.IsLinkLocalMulticast() || ip.IsLinkLocalUnicast() {
-			r.logger.Warn("Reserved address rejected: %s", host)
-			return false
-		}
-		// 允许公网IP
-		return true
-	}
-
-	// 检查域名是否在白名单中
-	for _, domain := range allowedDomains {
-		// 支持通配符，如*.example.com
-		if strings.HasPrefix(domain, "*") {
-			suffix := domain[1:]
-			if strings.HasSuffix(host, suffix) {
-				return true
-			}
-		} else if host == domain {
-			return true
-		}
-	}
-
-	r.logger.Warn("Domain not in whitelist: %s", host)
-	return false
-}
\ No newline at end of file
+	return true
+}
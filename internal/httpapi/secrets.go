@@ -0,0 +1,110 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"api-notify/internal/core"
+	"api-notify/internal/secrets"
+)
+
+// handlePartnerSecrets 处理合作方密钥库请求，密钥值只写不读
+// GET    /v1/partners/{partner_id}/secrets        列出密钥名称
+// PUT    /v1/partners/{partner_id}/secrets/{name} 创建或替换密钥
+// DELETE /v1/partners/{partner_id}/secrets/{name} 删除密钥
+func (r *Router) handlePartnerSecrets(w http.ResponseWriter, req *http.Request, partnerID string, parts []string) {
+	switch {
+	case len(parts) == 4 && req.Method == http.MethodGet:
+		r.handleListPartnerSecrets(w, req, partnerID)
+	case len(parts) == 5 && req.Method == http.MethodPut:
+		r.handlePutPartnerSecret(w, req, partnerID, parts[4])
+	case len(parts) == 5 && req.Method == http.MethodDelete:
+		r.handleDeletePartnerSecret(w, req, partnerID, parts[4])
+	default:
+		r.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handlePutPartnerSecret 加密保存合作方密钥，任务中通过{{name}}引用
+func (r *Router) handlePutPartnerSecret(w http.ResponseWriter, req *http.Request, partnerID, name string) {
+	var reqBody PutPartnerSecretRequest
+	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
+		r.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := secrets.ValidateName(name); err != nil {
+		r.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if reqBody.Value == "" {
+		r.writeError(w, http.StatusBadRequest, "Secret value is required")
+		return
+	}
+
+	if err := r.secrets.Put(req.Context(), partnerID, name, reqBody.Value); err != nil {
+		if errors.Is(err, secrets.ErrNoMasterKey) {
+			r.writeError(w, http.StatusServiceUnavailable, "Secrets master key is not configured")
+			return
+		}
+		r.logger.Error("Failed to save partner secret: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to save secret")
+		return
+	}
+
+	r.logger.Info("Secret %s saved for partner %s", name, partnerID)
+
+	r.writeJSON(w, http.StatusOK, toPartnerSecretResponse(&core.PartnerSecret{PartnerID: partnerID, Name: name}))
+}
+
+// handleListPartnerSecrets 列出合作方的密钥名称
+func (r *Router) handleListPartnerSecrets(w http.ResponseWriter, req *http.Request, partnerID string) {
+	list, err := r.secrets.List(req.Context(), partnerID)
+	if err != nil {
+		r.logger.Error("Failed to list partner secrets: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to list secrets")
+		return
+	}
+
+	resp := ListPartnerSecretsResponse{Secrets: make([]PartnerSecretResponse, 0, len(list))}
+	for _, secret := range list {
+		resp.Secrets = append(resp.Secrets, toPartnerSecretResponse(secret))
+	}
+
+	r.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleDeletePartnerSecret 删除合作方密钥，仍引用该密钥的任务派发时保留占位符
+func (r *Router) handleDeletePartnerSecret(w http.ResponseWriter, req *http.Request, partnerID, name string) {
+	found, err := r.secrets.Delete(req.Context(), partnerID, name)
+	if err != nil {
+		r.logger.Error("Failed to delete partner secret: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to delete secret")
+		return
+	}
+
+	if !found {
+		r.writeError(w, http.StatusNotFound, "Secret not found")
+		return
+	}
+
+	r.logger.Info("Secret %s deleted for partner %s", name, partnerID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// toPartnerSecretResponse 转换合作方密钥为响应（不含密钥值）
+func toPartnerSecretResponse(secret *core.PartnerSecret) PartnerSecretResponse {
+	resp := PartnerSecretResponse{
+		PartnerID:   secret.PartnerID,
+		Name:        secret.Name,
+		Placeholder: "{{" + secret.Name + "}}",
+	}
+	if !secret.CreatedAt.IsZero() {
+		resp.CreatedAt = secret.CreatedAt.Format(time.RFC3339)
+		resp.UpdatedAt = secret.UpdatedAt.Format(time.RFC3339)
+	}
+	return resp
+}
@@ -0,0 +1,224 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"api-notify/internal/core"
+	"api-notify/internal/payload"
+	"api-notify/internal/render"
+)
+
+// handleTemplates 处理合作方模板请求
+// GET    /v1/partners/{partner_id}/templates                列出模板
+// PUT    /v1/partners/{partner_id}/templates/{name}         创建或替换模板
+// GET    /v1/partners/{partner_id}/templates/{name}         获取模板
+// DELETE /v1/partners/{partner_id}/templates/{name}         删除模板
+// POST   /v1/partners/{partner_id}/templates/{name}/preview 使用示例数据预览渲染结果
+func (r *Router) handleTemplates(w http.ResponseWriter, req *http.Request, partnerID string, parts []string) {
+	switch {
+	case len(parts) == 4 && req.Method == http.MethodGet:
+		r.handleListTemplates(w, req, partnerID)
+	case len(parts) == 5 && req.Method == http.MethodPut:
+		r.handleSaveTemplate(w, req, partnerID, parts[4])
+	case len(parts) == 5 && req.Method == http.MethodGet:
+		r.handleGetTemplate(w, req, partnerID, parts[4])
+	case len(parts) == 5 && req.Method == http.MethodDelete:
+		r.handleDeleteTemplate(w, req, partnerID, parts[4])
+	case len(parts) == 6 && parts[5] == "preview" && req.Method == http.MethodPost:
+		r.handlePreviewTemplate(w, req, partnerID, parts[4])
+	default:
+		r.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleSaveTemplate 创建或替换模板，保存前编译校验语法
+func (r *Router) handleSaveTemplate(w http.ResponseWriter, req *http.Request, partnerID, name string) {
+	var reqBody SaveTemplateRequest
+	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
+		r.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tmpl := &core.Template{
+		PartnerID:    partnerID,
+		Name:         name,
+		BodyTemplate: reqBody.Body,
+		URLTemplate:  reqBody.URL,
+	}
+	if len(reqBody.Headers) > 0 {
+		data, err := json.Marshal(reqBody.Headers)
+		if err != nil {
+			r.writeError(w, http.StatusBadRequest, "Invalid headers template")
+			return
+		}
+		tmpl.HeadersTemplate = string(data)
+	}
+
+	if _, err := render.Compile(tmpl); err != nil {
+		r.writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid template: %v", err))
+		return
+	}
+
+	if err := r.store.SaveTemplate(req.Context(), tmpl); err != nil {
+		r.logger.Error("Failed to save template: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to save template")
+		return
+	}
+
+	r.logger.Info("Template %s saved for partner %s", name, partnerID)
+
+	r.writeJSON(w, http.StatusOK, toTemplateResponse(tmpl))
+}
+
+// handleListTemplates 列出合作方的模板
+func (r *Router) handleListTemplates(w http.ResponseWriter, req *http.Request, partnerID string) {
+	templates, err := r.store.ListTemplates(req.Context(), partnerID)
+	if err != nil {
+		r.logger.Error("Failed to list templates: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to list templates")
+		return
+	}
+
+	resp := ListTemplatesResponse{Templates: make([]TemplateResponse, 0, len(templates))}
+	for _, tmpl := range templates {
+		resp.Templates = append(resp.Templates, toTemplateResponse(tmpl))
+	}
+
+	r.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleGetTemplate 获取模板
+func (r *Router) handleGetTemplate(w http.ResponseWriter, req *http.Request, partnerID, name string) {
+	tmpl, err := r.store.GetTemplate(req.Context(), partnerID, name)
+	if err != nil {
+		r.logger.Error("Failed to get template: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to get template")
+		return
+	}
+
+	if tmpl == nil {
+		r.writeError(w, http.StatusNotFound, "Template not found")
+		return
+	}
+
+	r.writeJSON(w, http.StatusOK, toTemplateResponse(tmpl))
+}
+
+// handleDeleteTemplate 删除模板，仍引用该模板的待处理任务将在派发时渲染失败
+func (r *Router) handleDeleteTemplate(w http.ResponseWriter, req *http.Request, partnerID, name string) {
+	found, err := r.store.DeleteTemplate(req.Context(), partnerID, name)
+	if err != nil {
+		r.logger.Error("Failed to delete template: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to delete template")
+		return
+	}
+
+	if !found {
+		r.writeError(w, http.StatusNotFound, "Template not found")
+		return
+	}
+
+	r.logger.Info("Template %s deleted for partner %s", name, partnerID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlePreviewTemplate 使用请求中的数据渲染模板并返回结果，不创建任务
+func (r *Router) handlePreviewTemplate(w http.ResponseWriter, req *http.Request, partnerID, name string) {
+	var reqBody PreviewTemplateRequest
+	if err := json.NewDecoder(req.Body).Decode(&reqBody); err != nil {
+		r.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	tmpl, err := r.store.GetTemplate(req.Context(), partnerID, name)
+	if err != nil {
+		r.logger.Error("Failed to get template: %v", err)
+		r.writeError(w, http.StatusInternalServerError, "Failed to preview template")
+		return
+	}
+
+	if tmpl == nil {
+		r.writeError(w, http.StatusNotFound, "Template not found")
+		return
+	}
+
+	compiled, err := render.Compile(tmpl)
+	if err != nil {
+		r.writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	data, err := render.ParseData(string(reqBody.Data))
+	if err != nil {
+		r.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !payload.ValidEncoding(reqBody.BodyEncoding) {
+		r.writeError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported body_encoding %q", reqBody.BodyEncoding))
+		return
+	}
+
+	result, err := compiled.Execute(data, render.Target{
+		URL:          reqBody.TargetURL,
+		Headers:      reqBody.Headers,
+		BodyEncoding: reqBody.BodyEncoding,
+	})
+	if err != nil {
+		r.writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	r.writeJSON(w, http.StatusOK, PreviewTemplateResponse{
+		Body:    result.Body,
+		Headers: result.Headers,
+		URL:     result.URL,
+	})
+}
+
+// validateTemplate 校验任务引用的模板存在并能用任务数据渲染，返回错误对应的HTTP状态码
+func (r *Router) validateTemplate(ctx context.Context, task *core.NotificationTask) (int, error) {
+	tmpl, err := r.store.GetTemplate(ctx, task.PartnerID, task.TemplateName)
+	if err != nil {
+		r.logger.Error("Failed to get template: %v", err)
+		return http.StatusInternalServerError, fmt.Errorf("Failed to create notification")
+	}
+
+	if tmpl == nil {
+		return http.StatusBadRequest, fmt.Errorf("Template %q not found", task.TemplateName)
+	}
+
+	if _, err := render.Apply(task, tmpl); err != nil {
+		if errors.Is(err, render.ErrRender) {
+			return http.StatusBadRequest, err
+		}
+		r.logger.Error("Failed to render template: %v", err)
+		return http.StatusInternalServerError, fmt.Errorf("Failed to create notification")
+	}
+
+	return http.StatusOK, nil
+}
+
+// toTemplateResponse 转换模板为响应
+func toTemplateResponse(tmpl *core.Template) TemplateResponse {
+	resp := TemplateResponse{
+		PartnerID: tmpl.PartnerID,
+		Name:      tmpl.Name,
+		Body:      tmpl.BodyTemplate,
+		URL:       tmpl.URLTemplate,
+	}
+	if tmpl.HeadersTemplate != "" {
+		json.Unmarshal([]byte(tmpl.HeadersTemplate), &resp.Headers)
+	}
+	if !tmpl.CreatedAt.IsZero() {
+		resp.CreatedAt = tmpl.CreatedAt.Format(time.RFC3339)
+		resp.UpdatedAt = tmpl.UpdatedAt.Format(time.RFC3339)
+	}
+	return resp
+}
@@ -0,0 +1,165 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"api-notify/internal/store"
+	"api-notify/pkg/logging"
+)
+
+// Job 单例后台任务，ctx在失去领导权或服务退出时被取消
+type Job func(ctx context.Context)
+
+// Elector 基于数据库租约表的领导者选举
+// 多实例部署时只有持有租约的实例运行注册的单例任务，租约随心跳续约，
+// 持有者宕机后租约过期，由其他实例接管
+type Elector struct {
+	store         *store.Store
+	logger        *logging.Logger
+	name          string
+	instanceID    string
+	leaseTTL      time.Duration
+	renewInterval time.Duration
+
+	mu       sync.Mutex
+	jobs     map[string]Job
+	isLeader bool
+}
+
+// NewElector 创建领导者选举器
+// name为租约名称，同名租约的实例之间竞争；instanceID需在实例间唯一
+func NewElector(store *store.Store, logger *logging.Logger, name, instanceID string, leaseTTL, renewInterval time.Duration) *Elector {
+	if renewInterval <= 0 || renewInterval >= leaseTTL {
+		renewInterval = leaseTTL / 3
+	}
+
+	return &Elector{
+		store:         store,
+		logger:        logger,
+		name:          name,
+		instanceID:    instanceID,
+		leaseTTL:      leaseTTL,
+		renewInterval: renewInterval,
+		jobs:          make(map[string]Job),
+	}
+}
+
+// Register 注册单例任务，需在Run之前调用
+func (e *Elector) Register(name string, job Job) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.jobs[name] = job
+}
+
+// IsLeader 当前实例是否为领导者
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.isLeader
+}
+
+// Run 运行选举循环，直到ctx被取消；成为领导者时启动所有单例任务，失去领导权时停止
+func (e *Elector) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.renewInterval)
+	defer ticker.Stop()
+
+	var (
+		jobsCancel context.CancelFunc
+		jobsWG     sync.WaitGroup
+		lastRenew  time.Time
+	)
+
+	stopJobs := func() {
+		if jobsCancel != nil {
+			jobsCancel()
+			jobsWG.Wait()
+			jobsCancel = nil
+		}
+		e.setLeader(false)
+	}
+
+	for {
+		acquired, err := e.store.TryAcquireLease(ctx, e.name, e.instanceID, e.leaseTTL)
+		switch {
+		case err != nil:
+			e.logger.Error("Failed to renew lease %s: %v", e.name, err)
+			// 续约失败且租约可能已过期时主动放弃领导权，避免多个实例同时运行单例任务
+			if jobsCancel != nil && time.Since(lastRenew) >= e.leaseTTL {
+				e.logger.Warn("Lease %s may have expired, stepping down", e.name)
+				stopJobs()
+			}
+		case acquired:
+			lastRenew = time.Now()
+			if jobsCancel == nil {
+				e.logger.Info("Instance %s acquired leadership for %s", e.instanceID, e.name)
+				e.setLeader(true)
+				var jobsCtx context.Context
+				jobsCtx, jobsCancel = context.WithCancel(ctx)
+				e.startJobs(jobsCtx, &jobsWG)
+			}
+		default:
+			if jobsCancel != nil {
+				e.logger.Warn("Instance %s lost leadership for %s", e.instanceID, e.name)
+				stopJobs()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			wasLeader := jobsCancel != nil
+			stopJobs()
+			if wasLeader {
+				// 服务退出时释放租约，使其他实例无需等待过期即可接管
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := e.store.ReleaseLease(releaseCtx, e.name, e.instanceID); err != nil {
+					e.logger.Error("Failed to release lease %s: %v", e.name, err)
+				}
+				cancel()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startJobs 启动所有已注册的单例任务
+func (e *Elector) startJobs(ctx context.Context, wg *sync.WaitGroup) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for name, job := range e.jobs {
+		wg.Add(1)
+		go func(name string, job Job) {
+			defer wg.Done()
+			e.logger.Info("Singleton job %s started", name)
+			job(ctx)
+			e.logger.Info("Singleton job %s stopped", name)
+		}(name, job)
+	}
+}
+
+// setLeader 设置领导者状态
+func (e *Elector) setLeader(isLeader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.isLeader = isLeader
+}
+
+// Every 将函数包装为按固定间隔执行的单例任务
+func Every(interval time.Duration, fn func(ctx context.Context)) Job {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(ctx)
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"sync"
 	"time"
 
 	"api-notify/pkg/logging"
@@ -24,10 +25,36 @@ type Metrics interface {
 	// IncrDeadTask 增加dead任务计数
 	IncrDeadTask(taskID string, partnerID string)
 
+	// SetConcurrencyLimit 记录目标主机当前的自适应并发上限
+	SetConcurrencyLimit(host string, limit int)
+
+	// RecordConnectionTiming 记录单次请求的连接阶段耗时
+	RecordConnectionTiming(partnerID string, timing ConnectionTiming)
+
 	// GetStats 获取当前统计信息
 	GetStats() Stats
 }
 
+// ConnectionTiming 单次请求的连接阶段耗时，未发生的阶段为0
+type ConnectionTiming struct {
+	DNS             time.Duration
+	Connect         time.Duration
+	TLSHandshake    time.Duration
+	TimeToFirstByte time.Duration
+	Transfer        time.Duration
+	ConnReused      bool
+	// Connected 是否建立或复用了连接（连接前失败或非HTTP通道时为false）
+	Connected bool
+}
+
+// PartnerTiming 单个合作方的连接阶段耗时统计
+type PartnerTiming struct {
+	// AverageTiming 各阶段平均耗时，只统计实际发生的阶段
+	AverageTiming ConnectionTiming
+	// ConnReuseRate 连接复用率
+	ConnReuseRate float64
+}
+
 // Stats 指标统计信息
 type Stats struct {
 	InboundRequests  int64
@@ -37,6 +64,14 @@ type Stats struct {
 	AverageLatency   time.Duration
 	AverageRetries   float64
 	DeadTasks        int64
+	// ConcurrencyLimits 各目标主机当前的并发上限
+	ConcurrencyLimits map[string]int
+	// AverageTiming 各阶段平均耗时，只统计实际发生的阶段（DNS、连接、TLS只在新建连接时发生）
+	AverageTiming ConnectionTiming
+	// ConnReuseRate 连接复用率
+	ConnReuseRate float64
+	// PartnerTimings 各合作方的连接阶段耗时统计
+	PartnerTimings map[string]PartnerTiming
 }
 
 // SimpleMetrics 简单的内存指标收集器
@@ -51,12 +86,85 @@ type SimpleMetrics struct {
 	totalRetries      int64
 	retryCount        int64
 	deadTasks         int64
+
+	limitsMu          sync.Mutex
+	concurrencyLimits map[string]int
+
+	timingMu       sync.Mutex
+	timing         timingStats
+	partnerTimings map[string]*timingStats
+}
+
+// timingStats 连接阶段耗时的累计值，每个阶段只累计实际发生的样本
+type timingStats struct {
+	total         ConnectionTiming
+	dnsCount      int64
+	connectCount  int64
+	tlsCount      int64
+	ttfbCount     int64
+	transferCount int64
+	connCount     int64
+	reusedCount   int64
+}
+
+// add 累计一次请求的耗时，为0的阶段视为未发生，没有连接时不计入连接数
+func (s *timingStats) add(timing ConnectionTiming) {
+	if timing.DNS > 0 {
+		s.total.DNS += timing.DNS
+		s.dnsCount++
+	}
+	if timing.Connect > 0 {
+		s.total.Connect += timing.Connect
+		s.connectCount++
+	}
+	if timing.TLSHandshake > 0 {
+		s.total.TLSHandshake += timing.TLSHandshake
+		s.tlsCount++
+	}
+	if timing.TimeToFirstByte > 0 {
+		s.total.TimeToFirstByte += timing.TimeToFirstByte
+		s.ttfbCount++
+	}
+	if timing.Transfer > 0 {
+		s.total.Transfer += timing.Transfer
+		s.transferCount++
+	}
+	if timing.Connected {
+		s.connCount++
+		if timing.ConnReused {
+			s.reusedCount++
+		}
+	}
+}
+
+// stats 计算各阶段平均耗时和连接复用率
+func (s *timingStats) stats() PartnerTiming {
+	var result PartnerTiming
+	result.AverageTiming.DNS = average(s.total.DNS, s.dnsCount)
+	result.AverageTiming.Connect = average(s.total.Connect, s.connectCount)
+	result.AverageTiming.TLSHandshake = average(s.total.TLSHandshake, s.tlsCount)
+	result.AverageTiming.TimeToFirstByte = average(s.total.TimeToFirstByte, s.ttfbCount)
+	result.AverageTiming.Transfer = average(s.total.Transfer, s.transferCount)
+	if s.connCount > 0 {
+		result.ConnReuseRate = float64(s.reusedCount) / float64(s.connCount)
+	}
+	return result
+}
+
+// average 计算平均耗时，没有样本时为0
+func average(total time.Duration, count int64) time.Duration {
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
 }
 
 // NewSimpleMetrics 创建一个新的简单指标收集器
 func NewSimpleMetrics(logger *logging.Logger) *SimpleMetrics {
 	return &SimpleMetrics{
-		logger: logger,
+		logger:            logger,
+		concurrencyLimits: make(map[string]int),
+		partnerTimings:    make(map[string]*timingStats),
 	}
 }
 
@@ -99,6 +207,29 @@ func (m *SimpleMetrics) IncrDeadTask(taskID string, partnerID string) {
 	m.logger.Debug("Dead task incremented for task %s, partner %s", taskID, partnerID)
 }
 
+// SetConcurrencyLimit 记录目标主机当前的自适应并发上限
+func (m *SimpleMetrics) SetConcurrencyLimit(host string, limit int) {
+	m.limitsMu.Lock()
+	m.concurrencyLimits[host] = limit
+	m.limitsMu.Unlock()
+	m.logger.Debug("Concurrency limit for host %s set to %d", host, limit)
+}
+
+// RecordConnectionTiming 记录单次请求的连接阶段耗时
+func (m *SimpleMetrics) RecordConnectionTiming(partnerID string, timing ConnectionTiming) {
+	m.timingMu.Lock()
+	m.timing.add(timing)
+	partner, ok := m.partnerTimings[partnerID]
+	if !ok {
+		partner = &timingStats{}
+		m.partnerTimings[partnerID] = partner
+	}
+	partner.add(timing)
+	m.timingMu.Unlock()
+	m.logger.Debug("Connection timing recorded for partner %s: dns=%v connect=%v tls=%v ttfb=%v transfer=%v reused=%t connected=%t",
+		partnerID, timing.DNS, timing.Connect, timing.TLSHandshake, timing.TimeToFirstByte, timing.Transfer, timing.ConnReused, timing.Connected)
+}
+
 // GetStats 获取当前统计信息
 func (m *SimpleMetrics) GetStats() Stats {
 	averageLatency := time.Duration(0)
@@ -111,6 +242,21 @@ func (m *SimpleMetrics) GetStats() Stats {
 		averageRetries = float64(m.totalRetries) / float64(m.retryCount)
 	}
 
+	m.limitsMu.Lock()
+	concurrencyLimits := make(map[string]int, len(m.concurrencyLimits))
+	for host, limit := range m.concurrencyLimits {
+		concurrencyLimits[host] = limit
+	}
+	m.limitsMu.Unlock()
+
+	m.timingMu.Lock()
+	timing := m.timing.stats()
+	partnerTimings := make(map[string]PartnerTiming, len(m.partnerTimings))
+	for partnerID, partner := range m.partnerTimings {
+		partnerTimings[partnerID] = partner.stats()
+	}
+	m.timingMu.Unlock()
+
 	return Stats{
 		InboundRequests:   m.inboundRequests,
 		NotificationsSent: m.notificationsSent,
@@ -119,5 +265,9 @@ func (m *SimpleMetrics) GetStats() Stats {
 		AverageLatency:    averageLatency,
 		AverageRetries:    averageRetries,
 		DeadTasks:         m.deadTasks,
+		ConcurrencyLimits: concurrencyLimits,
+		AverageTiming:     timing.AverageTiming,
+		ConnReuseRate:     timing.ConnReuseRate,
+		PartnerTimings:    partnerTimings,
 	}
 }
\ No newline at end of file
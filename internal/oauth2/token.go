@@ -0,0 +1,172 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"api-notify/pkg/httpclient"
+	"api-notify/pkg/logging"
+)
+
+// Credentials OAuth2客户端凭证模式的配置
+type Credentials struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	Audience     string
+}
+
+// defaultExpiry 令牌端点未返回expires_in时的默认有效期
+const defaultExpiry = time.Hour
+
+// refreshSkew 在令牌过期前提前刷新的时间，有效期较短的令牌最多提前其有效期的一半（见refreshBefore）
+const refreshSkew = 60 * time.Second
+
+// TokenCache 按合作方缓存访问令牌
+// 令牌只保存在内存中，不会写入任务或数据库
+type TokenCache struct {
+	client *httpclient.Client
+	logger *logging.Logger
+
+	mu      sync.Mutex
+	entries map[string]*tokenEntry
+}
+
+// tokenEntry 单个合作方的令牌缓存，mu保证同一合作方同时只有一个刷新请求
+type tokenEntry struct {
+	mu    sync.Mutex
+	token string
+	// refreshAt 到达该时间后重新获取令牌（过期时间减去提前刷新的时间）
+	refreshAt time.Time
+}
+
+// tokenResponse 令牌端点响应
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// NewTokenCache 创建令牌缓存，令牌请求通过client发送（沿用合作方的TLS配置档）
+func NewTokenCache(client *httpclient.Client, logger *logging.Logger) *TokenCache {
+	return &TokenCache{
+		client:  client,
+		logger:  logger,
+		entries: make(map[string]*tokenEntry),
+	}
+}
+
+// Token 获取合作方的访问令牌，缓存过期或即将过期时重新获取
+func (c *TokenCache) Token(ctx context.Context, partnerID string, creds Credentials) (string, error) {
+	entry := c.entry(partnerID)
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.token != "" && time.Now().Before(entry.refreshAt) {
+		return entry.token, nil
+	}
+
+	token, expiresIn, err := c.fetch(ctx, partnerID, creds)
+	if err != nil {
+		return "", err
+	}
+
+	entry.token = token
+	entry.refreshAt = time.Now().Add(expiresIn - refreshBefore(expiresIn))
+	c.logger.Debug("OAuth2 token refreshed for partner %s, expires in %v", partnerID, expiresIn)
+
+	return token, nil
+}
+
+// Invalidate 使合作方的缓存令牌失效（如接收方返回401）
+func (c *TokenCache) Invalidate(partnerID string) {
+	entry := c.entry(partnerID)
+
+	entry.mu.Lock()
+	entry.token = ""
+	entry.refreshAt = time.Time{}
+	entry.mu.Unlock()
+}
+
+// refreshBefore 令牌过期前提前刷新的时间，不超过有效期的一半，避免有效期短于refreshSkew的令牌每次都重新获取
+func refreshBefore(lifetime time.Duration) time.Duration {
+	if half := lifetime / 2; half < refreshSkew {
+		return half
+	}
+	return refreshSkew
+}
+
+// entry 获取或创建合作方的缓存项
+func (c *TokenCache) entry(partnerID string) *tokenEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[partnerID]
+	if !ok {
+		entry = &tokenEntry{}
+		c.entries[partnerID] = entry
+	}
+	return entry
+}
+
+// fetch 向令牌端点请求新令牌（client_secret_basic认证）
+func (c *TokenCache) fetch(ctx context.Context, partnerID string, creds Credentials) (string, time.Duration, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	if len(creds.Scopes) > 0 {
+		form.Set("scope", strings.Join(creds.Scopes, " "))
+	}
+	if creds.Audience != "" {
+		form.Set("audience", creds.Audience)
+	}
+
+	basic := url.QueryEscape(creds.ClientID) + ":" + url.QueryEscape(creds.ClientSecret)
+	headers := map[string]string{
+		"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(basic)),
+		"Content-Type":  "application/x-www-form-urlencoded",
+		"Accept":        "application/json",
+	}
+
+	resp, err := c.client.Send(ctx, &httpclient.Request{
+		Method:  "POST",
+		URL:     creds.TokenURL,
+		Headers: headers,
+		Body:    []byte(form.Encode()),
+		Profile: partnerID,
+		// 响应中包含访问令牌，不写入日志
+		OmitResponseBodyLog: true,
+	})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to request oauth2 token: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", 0, fmt.Errorf("oauth2 token endpoint returned status %d", resp.StatusCode)
+	}
+
+	var tokenResp tokenResponse
+	if err := json.Unmarshal(resp.Body, &tokenResp); err != nil {
+		return "", 0, fmt.Errorf("failed to parse oauth2 token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", 0, fmt.Errorf("oauth2 token response has no access_token")
+	}
+	if tokenResp.TokenType != "" && !strings.EqualFold(tokenResp.TokenType, "bearer") {
+		return "", 0, fmt.Errorf("unsupported oauth2 token type %q", tokenResp.TokenType)
+	}
+
+	expiresIn := defaultExpiry
+	if tokenResp.ExpiresIn > 0 {
+		expiresIn = time.Duration(tokenResp.ExpiresIn) * time.Second
+	}
+
+	return tokenResp.AccessToken, expiresIn, nil
+}
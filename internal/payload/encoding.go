@@ -0,0 +1,166 @@
+package payload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// 请求体编码方式
+const (
+	// EncodingJSON 请求体为JSON，原样发送（默认）
+	EncodingJSON = "json"
+	// EncodingForm 请求体为JSON对象，按application/x-www-form-urlencoded编码发送
+	EncodingForm = "form"
+	// EncodingText 请求体为JSON字符串，以其文本内容发送（如XML、纯文本）
+	EncodingText = "text"
+	// EncodingBase64Binary 请求体为base64编码的JSON字符串，解码后以原始字节发送
+	EncodingBase64Binary = "base64-binary"
+)
+
+// defaultContentTypes 各编码方式未指定Content-Type时使用的默认值
+var defaultContentTypes = map[string]string{
+	EncodingJSON:         "application/json",
+	EncodingForm:         "application/x-www-form-urlencoded",
+	EncodingText:         "text/plain; charset=utf-8",
+	EncodingBase64Binary: "application/octet-stream",
+}
+
+// ValidEncoding 判断编码方式是否受支持，空值等同于json
+func ValidEncoding(encoding string) bool {
+	if encoding == "" {
+		return true
+	}
+	_, ok := defaultContentTypes[encoding]
+	return ok
+}
+
+// ContentType 返回编码方式对应的默认Content-Type
+func ContentType(encoding string) string {
+	if contentType, ok := defaultContentTypes[encoding]; ok {
+		return contentType
+	}
+	return defaultContentTypes[EncodingJSON]
+}
+
+// Normalize 将API提交的请求体转换为任务中保存的形式
+// json原样保存；form保存为URL编码后的字符串；text保存文本内容；base64-binary保存base64字符串（发送时解码）
+func Normalize(encoding string, raw json.RawMessage) (string, error) {
+	if encoding == "" || encoding == EncodingJSON {
+		return string(raw), nil
+	}
+
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return "", nil
+	}
+
+	switch encoding {
+	case EncodingForm:
+		return encodeForm(raw)
+	case EncodingText:
+		var text string
+		if err := json.Unmarshal(raw, &text); err != nil {
+			return "", fmt.Errorf("body must be a JSON string for body_encoding %q", encoding)
+		}
+		return text, nil
+	case EncodingBase64Binary:
+		var encoded string
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return "", fmt.Errorf("body must be a JSON string for body_encoding %q", encoding)
+		}
+		if _, err := base64.StdEncoding.DecodeString(encoded); err != nil {
+			return "", fmt.Errorf("body is not valid base64: %w", err)
+		}
+		return encoded, nil
+	default:
+		return "", fmt.Errorf("unsupported body_encoding %q", encoding)
+	}
+}
+
+// Validate 校验任务中保存的请求体（如模板渲染结果）符合编码方式
+func Validate(encoding, stored string) error {
+	switch encoding {
+	case "", EncodingJSON, EncodingText:
+		return nil
+	case EncodingForm:
+		if _, err := url.ParseQuery(stored); err != nil {
+			return fmt.Errorf("body is not valid form data: %w", err)
+		}
+		return nil
+	case EncodingBase64Binary:
+		if _, err := base64.StdEncoding.DecodeString(stored); err != nil {
+			return fmt.Errorf("body is not valid base64: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported body_encoding %q", encoding)
+	}
+}
+
+// Decode 将任务中保存的请求体转换为实际发送的字节
+func Decode(encoding, stored string) ([]byte, error) {
+	if encoding == EncodingBase64Binary {
+		data, err := base64.StdEncoding.DecodeString(stored)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode base64 body: %w", err)
+		}
+		return data, nil
+	}
+	return []byte(stored), nil
+}
+
+// encodeForm 将JSON对象编码为表单，值可以是字符串、数字、布尔值或它们组成的数组，null字段被忽略
+func encodeForm(raw json.RawMessage) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var fields map[string]interface{}
+	if err := decoder.Decode(&fields); err != nil {
+		return "", fmt.Errorf("body must be a JSON object for body_encoding %q", EncodingForm)
+	}
+
+	// url.Values.Encode按字段名排序，编码结果稳定
+	values := url.Values{}
+	for key, field := range fields {
+		switch v := field.(type) {
+		case nil:
+			continue
+		case []interface{}:
+			for _, item := range v {
+				s, err := formValue(key, item)
+				if err != nil {
+					return "", err
+				}
+				values.Add(key, s)
+			}
+		default:
+			s, err := formValue(key, v)
+			if err != nil {
+				return "", err
+			}
+			values.Add(key, s)
+		}
+	}
+
+	return values.Encode(), nil
+}
+
+// formValue 将标量值转换为表单字段值
+func formValue(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	default:
+		return "", fmt.Errorf("form field %q must be a string, number, boolean or an array of them", key)
+	}
+}
@@ -0,0 +1,343 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"api-notify/internal/core"
+	"api-notify/internal/payload"
+)
+
+// ErrRender 模板渲染失败（数据缺少字段、渲染结果不合法等）
+var ErrRender = errors.New("template render failed")
+
+// namePattern 模板名称格式
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// maxHeaderTemplates 单个模板最多包含的请求头模板数
+const maxHeaderTemplates = 32
+
+// funcs 模板可用的辅助函数，json用于在JSON请求体中安全地输出任意值
+var funcs = template.FuncMap{
+	"json":           toJSON,
+	"default":        defaultValue,
+	"upper":          strings.ToUpper,
+	"lower":          strings.ToLower,
+	"trim":           strings.TrimSpace,
+	"urlPathEscape":  url.PathEscape,
+	"urlQueryEscape": url.QueryEscape,
+	"secret":         secretPlaceholder,
+}
+
+// Template 编译后的合作方模板
+type Template struct {
+	name    string
+	body    *template.Template
+	headers map[string]*template.Template
+	url     *template.Template
+}
+
+// Target 渲染时使用的任务信息
+type Target struct {
+	// URL 任务目标URL，URL模板的渲染结果相对它解析
+	URL string
+	// Headers 任务自带的请求头，同名时优先于模板请求头
+	Headers map[string]string
+	// BodyEncoding 任务的请求体编码方式，渲染出的请求体需符合该编码
+	BodyEncoding string
+}
+
+// Result 模板渲染结果，未定义的部分为空
+type Result struct {
+	Body    string
+	Headers map[string]string
+	URL     string
+}
+
+// ValidateName 校验模板名称
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("template name must match %s", namePattern.String())
+	}
+	return nil
+}
+
+// Compile 编译合作方模板，语法错误时返回错误
+func Compile(tmpl *core.Template) (*Template, error) {
+	if err := ValidateName(tmpl.Name); err != nil {
+		return nil, err
+	}
+
+	compiled := &Template{name: tmpl.Name, headers: make(map[string]*template.Template)}
+
+	var err error
+	if tmpl.BodyTemplate != "" {
+		if compiled.body, err = parse(tmpl.Name+".body", tmpl.BodyTemplate); err != nil {
+			return nil, err
+		}
+	}
+
+	if tmpl.HeadersTemplate != "" {
+		var headers map[string]string
+		if err := json.Unmarshal([]byte(tmpl.HeadersTemplate), &headers); err != nil {
+			return nil, fmt.Errorf("headers template must be a JSON object of strings: %w", err)
+		}
+		if len(headers) > maxHeaderTemplates {
+			return nil, fmt.Errorf("headers template must have at most %d headers", maxHeaderTemplates)
+		}
+		for name, text := range headers {
+			if !validHeaderName(name) {
+				return nil, fmt.Errorf("invalid header name %q", name)
+			}
+			if compiled.headers[name], err = parse(tmpl.Name+".headers."+name, text); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if tmpl.URLTemplate != "" {
+		if compiled.url, err = parse(tmpl.Name+".url", tmpl.URLTemplate); err != nil {
+			return nil, err
+		}
+	}
+
+	if compiled.body == nil && len(compiled.headers) == 0 && compiled.url == nil {
+		return nil, fmt.Errorf("template must define at least one of body, headers or url")
+	}
+
+	return compiled, nil
+}
+
+// parse 解析单个模板，引用数据中不存在的字段时渲染失败
+func parse(name, text string) (*template.Template, error) {
+	t, err := template.New(name).Option("missingkey=error").Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return t, nil
+}
+
+// ParseData 解析模板数据（JSON对象），数字保留原始精度
+func ParseData(raw string) (map[string]interface{}, error) {
+	data := make(map[string]interface{})
+	if strings.TrimSpace(raw) == "" {
+		return data, nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("template data must be a JSON object: %w", err)
+	}
+	return data, nil
+}
+
+// Execute 使用数据渲染模板
+// 渲染出的URL为路径和查询参数，相对目标URL解析，不能改变协议和主机；
+// json编码下最终的Content-Type未设置或为JSON类型时，渲染出的请求体必须是合法JSON，其他编码按编码方式校验
+func (t *Template) Execute(data map[string]interface{}, target Target) (*Result, error) {
+	result := &Result{}
+
+	if t.body != nil {
+		body, err := execute(t.body, data)
+		if err != nil {
+			return nil, err
+		}
+		result.Body = body
+	}
+
+	if len(t.headers) > 0 {
+		result.Headers = make(map[string]string, len(t.headers))
+		for name, tmpl := range t.headers {
+			value, err := execute(tmpl, data)
+			if err != nil {
+				return nil, err
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				return nil, fmt.Errorf("%w: header %s contains a line break", ErrRender, name)
+			}
+			result.Headers[name] = value
+		}
+	}
+
+	if t.body != nil {
+		if err := checkBody(result.Body, target, result.Headers); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.url != nil {
+		rendered, err := execute(t.url, data)
+		if err != nil {
+			return nil, err
+		}
+		resolved, err := resolveURL(target.URL, strings.TrimSpace(rendered))
+		if err != nil {
+			return nil, err
+		}
+		result.URL = resolved
+	}
+
+	return result, nil
+}
+
+// execute 渲染单个模板
+func execute(tmpl *template.Template, data map[string]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrRender, err)
+	}
+	return buf.String(), nil
+}
+
+// resolveURL 将渲染出的路径和查询参数应用到目标URL
+func resolveURL(targetURL, rendered string) (string, error) {
+	base, err := url.Parse(targetURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid target url: %v", ErrRender, err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return "", fmt.Errorf("%w: url template requires an http or https target", ErrRender)
+	}
+
+	if !strings.HasPrefix(rendered, "/") && !strings.HasPrefix(rendered, "?") || strings.HasPrefix(rendered, "//") {
+		return "", fmt.Errorf("%w: rendered url must be a path starting with / or a query starting with ?", ErrRender)
+	}
+	ref, err := url.Parse(rendered)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid rendered url: %v", ErrRender, err)
+	}
+
+	return base.ResolveReference(ref).String(), nil
+}
+
+// checkBody 校验渲染出的请求体符合任务的编码方式
+func checkBody(body string, target Target, templateHeaders map[string]string) error {
+	if target.BodyEncoding != "" && target.BodyEncoding != payload.EncodingJSON {
+		if err := payload.Validate(target.BodyEncoding, body); err != nil {
+			return fmt.Errorf("%w: %v", ErrRender, err)
+		}
+		return nil
+	}
+
+	if isJSONContent(target.Headers, templateHeaders) && !json.Valid([]byte(body)) {
+		return fmt.Errorf("%w: rendered body is not valid JSON", ErrRender)
+	}
+	return nil
+}
+
+// isJSONContent 判断请求是否使用JSON内容类型，按顺序取第一个设置了Content-Type的请求头集合（均未设置时默认JSON）
+func isJSONContent(headerSets ...map[string]string) bool {
+	for _, headers := range headerSets {
+		for name, value := range headers {
+			if strings.EqualFold(name, "Content-Type") {
+				return strings.Contains(strings.ToLower(value), "json")
+			}
+		}
+	}
+	return true
+}
+
+// validHeaderName 校验请求头名称只包含token字符
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if c > 127 || !strings.ContainsRune("!#$%&'*+-.^_`|~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// toJSON 将值编码为JSON文本，字符串会带引号并转义
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// secretPlaceholder 输出密钥占位符 {{NAME}}，由派发器在发送时替换为真实值
+// 模板本身使用{{}}作为语法，因此需要通过该函数生成占位符，用法：{{secret "API_KEY"}}
+func secretPlaceholder(name string) string {
+	return "{{" + name + "}}"
+}
+
+// defaultValue 值为空时返回默认值，用法：{{default "n/a" .field}}
+func defaultValue(def interface{}, v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil:
+		return def
+	case string:
+		if value == "" {
+			return def
+		}
+	}
+	return v
+}
+
+// Apply 使用任务的模板数据渲染模板，返回渲染后的任务副本，原任务不变
+// 模板定义的请求体和URL替换任务中的值；请求头与任务请求头合并，任务中同名的请求头优先
+func Apply(task *core.NotificationTask, tmpl *core.Template) (*core.NotificationTask, error) {
+	compiled, err := Compile(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRender, err)
+	}
+	data, err := ParseData(task.TemplateData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRender, err)
+	}
+
+	headers := make(map[string]string)
+	if task.Headers != "" {
+		if err := json.Unmarshal([]byte(task.Headers), &headers); err != nil {
+			return nil, fmt.Errorf("failed to parse task headers: %w", err)
+		}
+	}
+
+	result, err := compiled.Execute(data, Target{URL: task.TargetURL, Headers: headers, BodyEncoding: task.BodyEncoding})
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := *task
+	if compiled.body != nil {
+		rendered.Body = result.Body
+	}
+	if compiled.url != nil {
+		rendered.TargetURL = result.URL
+	}
+	if len(result.Headers) > 0 {
+		for name, value := range result.Headers {
+			if !HasHeader(headers, name) {
+				headers[name] = value
+			}
+		}
+		encoded, err := json.Marshal(headers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode headers: %w", err)
+		}
+		rendered.Headers = string(encoded)
+	}
+
+	return &rendered, nil
+}
+
+// HasHeader 判断请求头是否存在（忽略大小写）
+func HasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrDecrypt 密文无法解密（主密钥不匹配或数据被篡改）
+var ErrDecrypt = errors.New("failed to decrypt secret")
+
+// ciphertextPrefix 密文格式版本前缀
+const ciphertextPrefix = "v1:"
+
+// Cipher AES-256-GCM加解密
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// ParseKey 解析base64编码的32字节密钥
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("master key must be base64 encoded: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// NewCipher 使用32字节密钥创建加解密器
+func NewCipher(key []byte) (*Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gcm: %w", err)
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// Seal 加密明文，aad绑定密文的归属（如合作方和密钥名），解密时必须一致
+func (c *Cipher) Seal(plaintext, aad []byte) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := c.aead.Seal(nonce, nonce, plaintext, aad)
+	return ciphertextPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open 解密Seal生成的密文
+func (c *Cipher) Open(ciphertext string, aad []byte) ([]byte, error) {
+	if !strings.HasPrefix(ciphertext, ciphertextPrefix) {
+		return nil, fmt.Errorf("%w: unknown ciphertext format", ErrDecrypt)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, ciphertextPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrDecrypt)
+	}
+
+	nonce, data := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, data, aad)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecrypt, err)
+	}
+	return plaintext, nil
+}
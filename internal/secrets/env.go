@@ -0,0 +1,56 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"strings"
+)
+
+// envSeparator 环境变量名中合作方ID与密钥名之间的分隔符
+const envSeparator = "__"
+
+// EnvProvider 从环境变量读取密钥，变量名为 前缀+合作方ID+__+密钥名，如 NOTIFY_SECRET_partner_123__API_KEY
+// 合作方ID和密钥名保持原样（区分大小写），只能包含字母、数字和单个下划线，且不以下划线开头或结尾，
+// 保证不同合作方的密钥不会映射到同一个变量名；其他合作方ID或密钥名不从环境变量读取
+type EnvProvider struct {
+	prefix string
+}
+
+// NewEnvProvider 创建环境变量来源
+func NewEnvProvider(prefix string) *EnvProvider {
+	return &EnvProvider{prefix: prefix}
+}
+
+// Name 来源名称
+func (p *EnvProvider) Name() string { return "env" }
+
+// Get 查找合作方的密钥
+func (p *EnvProvider) Get(_ context.Context, partnerID, name string) (string, bool, error) {
+	varName, ok := p.VarName(partnerID, name)
+	if !ok {
+		return "", false, nil
+	}
+	value, ok := os.LookupEnv(varName)
+	return value, ok, nil
+}
+
+// VarName 返回合作方密钥对应的环境变量名，合作方ID或密钥名无法无歧义地编码时返回false
+func (p *EnvProvider) VarName(partnerID, name string) (string, bool) {
+	if !envSegment(partnerID) || !envSegment(name) {
+		return "", false
+	}
+	return p.prefix + partnerID + envSeparator + name, true
+}
+
+// envSegment 判断能否作为环境变量名片段：只含字母、数字和下划线，不含分隔符，不以下划线开头或结尾
+func envSegment(s string) bool {
+	if s == "" || strings.HasPrefix(s, "_") || strings.HasSuffix(s, "_") || strings.Contains(s, envSeparator) {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
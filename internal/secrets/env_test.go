@@ -0,0 +1,61 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEnvProviderVarNamesDoNotCollide(t *testing.T) {
+	provider := NewEnvProvider("NOTIFY_SECRET_")
+
+	pairs := [][2]string{
+		{"acme", "PROD_API_KEY"},
+		{"acme_prod", "API_KEY"},
+		{"acme_PROD", "API_KEY"},
+		{"ACME", "PROD_API_KEY"},
+		{"acme", "prod_API_KEY"},
+	}
+	seen := make(map[string][2]string)
+	for _, pair := range pairs {
+		name, ok := provider.VarName(pair[0], pair[1])
+		if !ok {
+			t.Fatalf("VarName(%q, %q) rejected a valid pair", pair[0], pair[1])
+		}
+		if other, dup := seen[name]; dup {
+			t.Fatalf("VarName(%q, %q) = %q collides with %v", pair[0], pair[1], name, other)
+		}
+		seen[name] = pair
+	}
+
+	// 无法无歧义编码的合作方ID和密钥名不从环境变量读取
+	for _, pair := range [][2]string{
+		{"acme-prod", "API_KEY"},
+		{"acme", "API-KEY"},
+		{"acme_", "API_KEY"},
+		{"acme", "_API_KEY"},
+		{"acme__prod", "API_KEY"},
+		{"acme", "API__KEY"},
+		{"", "API_KEY"},
+		{"acme.prod", "API_KEY"},
+	} {
+		if name, ok := provider.VarName(pair[0], pair[1]); ok {
+			t.Errorf("VarName(%q, %q) = %q, want rejected", pair[0], pair[1], name)
+		}
+	}
+}
+
+func TestEnvProviderGetIsolatesPartners(t *testing.T) {
+	provider := NewEnvProvider("NOTIFY_SECRET_")
+	t.Setenv("NOTIFY_SECRET_acme__PROD_API_KEY", "acme-secret")
+	ctx := context.Background()
+
+	value, found, err := provider.Get(ctx, "acme", "PROD_API_KEY")
+	if err != nil || !found || value != "acme-secret" {
+		t.Fatalf("Get(acme, PROD_API_KEY) = %q, %v, %v; want acme-secret", value, found, err)
+	}
+	for _, pair := range [][2]string{{"acme_prod", "API_KEY"}, {"acme-prod", "API_KEY"}, {"ACME", "PROD_API_KEY"}} {
+		if value, found, _ := provider.Get(ctx, pair[0], pair[1]); found {
+			t.Fatalf("Get(%q, %q) = %q, want not found", pair[0], pair[1], value)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"api-notify/pkg/logging"
+)
+
+// FileProvider 从挂载的密钥目录读取密钥，文件路径为 目录/合作方ID/密钥名，文件内容为密钥值（去除末尾换行）
+// 兼容Kubernetes Secret卷的目录结构（以..开头的内部目录和符号链接）
+type FileProvider struct {
+	dir    string
+	logger *logging.Logger
+}
+
+// NewFileProvider 创建文件来源
+func NewFileProvider(dir string, logger *logging.Logger) *FileProvider {
+	return &FileProvider{dir: dir, logger: logger}
+}
+
+// Name 来源名称
+func (p *FileProvider) Name() string { return "file" }
+
+// Get 查找合作方的密钥
+func (p *FileProvider) Get(_ context.Context, partnerID, name string) (string, bool, error) {
+	if !safePathSegment(partnerID) || !safePathSegment(name) {
+		return "", false, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(p.dir, partnerID, name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+// Watch 定期检查密钥目录，内容变化时调用onChange（如清除密钥缓存），直到ctx结束；interval不大于0时不检查
+func (p *FileProvider) Watch(ctx context.Context, interval time.Duration, onChange func()) {
+	if interval <= 0 {
+		p.logger.Info("Secret directory watching disabled (interval %v)", interval)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := p.fingerprint()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			current := p.fingerprint()
+			if current == last {
+				continue
+			}
+			last = current
+			p.logger.Info("Secret directory %s changed, reloading secrets", p.dir)
+			onChange()
+		}
+	}
+}
+
+// fingerprint 目录中所有密钥文件的路径、大小和修改时间，用于检测变化
+func (p *FileProvider) fingerprint() string {
+	var b strings.Builder
+	partners, err := os.ReadDir(p.dir)
+	if err != nil {
+		return "error:" + err.Error()
+	}
+	for _, partner := range partners {
+		if strings.HasPrefix(partner.Name(), ".") {
+			continue
+		}
+		partnerDir := filepath.Join(p.dir, partner.Name())
+		files, err := os.ReadDir(partnerDir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if strings.HasPrefix(file.Name(), ".") {
+				continue
+			}
+			// 使用Stat跟随符号链接，取得实际文件的信息
+			info, err := os.Stat(filepath.Join(partnerDir, file.Name()))
+			if err != nil || info.IsDir() {
+				continue
+			}
+			fmt.Fprintf(&b, "%s/%s:%d:%d\n", partner.Name(), file.Name(), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
+
+// safePathSegment 判断是否可以作为单级路径使用，防止目录穿越
+func safePathSegment(s string) bool {
+	return s != "" && s != "." && s != ".." && !strings.ContainsAny(s, `/\`) && !strings.HasPrefix(s, "..")
+}
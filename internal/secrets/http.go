@@ -0,0 +1,79 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HTTPProvider 从兼容Vault KV v2接口的密钥服务读取密钥
+// 请求 GET {URL}/v1/{Mount}/data/{合作方ID}/{密钥名}，以X-Vault-Token认证，
+// 密钥值取响应中 data.data.value 字段，404表示不存在
+type HTTPProvider struct {
+	baseURL string
+	token   string
+	mount   string
+	client  *http.Client
+}
+
+// NewHTTPProvider 创建HTTP密钥服务来源
+func NewHTTPProvider(baseURL, token, mount string, timeout time.Duration) *HTTPProvider {
+	return &HTTPProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		mount:   strings.Trim(mount, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Name 来源名称
+func (p *HTTPProvider) Name() string { return "http" }
+
+// kvResponse KV v2读取接口的响应
+type kvResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+// Get 查找合作方的密钥
+func (p *HTTPProvider) Get(ctx context.Context, partnerID, name string) (string, bool, error) {
+	secretURL := fmt.Sprintf("%s/v1/%s/data/%s/%s", p.baseURL, p.mount, url.PathEscape(partnerID), url.PathEscape(name))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, secretURL, nil)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create secret request: %w", err)
+	}
+	if p.token != "" {
+		req.Header.Set("X-Vault-Token", p.token)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to fetch secret: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("secret service returned status %d", resp.StatusCode)
+	}
+
+	var kv kvResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&kv); err != nil {
+		return "", false, fmt.Errorf("failed to decode secret response: %w", err)
+	}
+
+	value, ok := kv.Data.Data["value"].(string)
+	if !ok {
+		return "", false, fmt.Errorf("secret %s for partner %s has no string value field", name, partnerID)
+	}
+	return value, true, nil
+}
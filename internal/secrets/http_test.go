@@ -0,0 +1,186 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"api-notify/pkg/logging"
+)
+
+// kvServer 测试用的KV v2密钥服务，按路径返回密钥，status非0时直接返回该状态码
+type kvServer struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	values   map[string]string
+	status   int
+	requests int
+	tokens   []string
+}
+
+// newKVServer 启动密钥服务
+func newKVServer(t *testing.T, values map[string]string) *kvServer {
+	t.Helper()
+	s := &kvServer{values: values}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	t.Cleanup(s.server.Close)
+	return s
+}
+
+// handle 处理 GET /v1/{mount}/data/{路径}
+func (s *kvServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	s.tokens = append(s.tokens, r.Header.Get("X-Vault-Token"))
+
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	value, ok := s.values[r.URL.Path]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"data":{"data":{"value":"` + value + `"},"metadata":{"version":1}}}`))
+}
+
+// set 修改密钥服务的返回
+func (s *kvServer) set(path, value string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if path != "" {
+		s.values[path] = value
+	}
+	s.status = status
+}
+
+// requestCount 返回收到的请求数
+func (s *kvServer) requestCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func TestHTTPProviderGet(t *testing.T) {
+	server := newKVServer(t, map[string]string{
+		"/v1/secret/data/partner-a/API_TOKEN": "tok-123",
+	})
+	provider := NewHTTPProvider(server.server.URL+"/", "vault-token", "/secret/", time.Second)
+	ctx := context.Background()
+
+	value, found, err := provider.Get(ctx, "partner-a", "API_TOKEN")
+	if err != nil || !found || value != "tok-123" {
+		t.Fatalf("Get() = %q, %v, %v; want tok-123, true, nil", value, found, err)
+	}
+	if server.tokens[0] != "vault-token" {
+		t.Fatalf("X-Vault-Token = %q, want vault-token", server.tokens[0])
+	}
+
+	// 404：密钥不存在，不是错误
+	value, found, err = provider.Get(ctx, "partner-b", "API_TOKEN")
+	if err != nil || found || value != "" {
+		t.Fatalf("Get() on 404 = %q, %v, %v; want empty, false, nil", value, found, err)
+	}
+
+	// 5xx：密钥服务故障
+	server.set("", "", http.StatusServiceUnavailable)
+	if _, found, err := provider.Get(ctx, "partner-a", "API_TOKEN"); err == nil || found {
+		t.Fatalf("Get() on 503 = %v, %v; want error", found, err)
+	}
+}
+
+func TestResolverTTLExpiry(t *testing.T) {
+	const path = "/v1/secret/data/partner-a/API_TOKEN"
+	server := newKVServer(t, map[string]string{path: "v1"})
+	provider := NewHTTPProvider(server.server.URL, "", "secret", time.Second)
+	resolver := NewResolver(logging.New("error"), 50*time.Millisecond, provider)
+	ctx := context.Background()
+
+	if value, _, _ := resolver.Get(ctx, "partner-a", "API_TOKEN"); value != "v1" {
+		t.Fatalf("first Get() = %q, want v1", value)
+	}
+
+	// 缓存有效期内不再请求密钥服务
+	server.set(path, "v2", 0)
+	if value, _, _ := resolver.Get(ctx, "partner-a", "API_TOKEN"); value != "v1" {
+		t.Fatalf("cached Get() = %q, want v1", value)
+	}
+	if n := server.requestCount(); n != 1 {
+		t.Fatalf("secret service got %d requests within ttl, want 1", n)
+	}
+
+	// 过期后重新读取
+	time.Sleep(80 * time.Millisecond)
+	if value, _, _ := resolver.Get(ctx, "partner-a", "API_TOKEN"); value != "v2" {
+		t.Fatalf("Get() after ttl = %q, want v2", value)
+	}
+	if n := server.requestCount(); n != 2 {
+		t.Fatalf("secret service got %d requests, want 2", n)
+	}
+}
+
+func TestResolverStaleOnError(t *testing.T) {
+	const path = "/v1/secret/data/partner-a/API_TOKEN"
+	server := newKVServer(t, map[string]string{path: "v1"})
+	provider := NewHTTPProvider(server.server.URL, "", "secret", time.Second)
+	resolver := NewResolver(logging.New("error"), 20*time.Millisecond, provider)
+	ctx := context.Background()
+
+	if value, _, err := resolver.Get(ctx, "partner-a", "API_TOKEN"); err != nil || value != "v1" {
+		t.Fatalf("first Get() = %q, %v; want v1", value, err)
+	}
+
+	// 过期后密钥服务故障：继续使用旧值
+	server.set("", "", http.StatusInternalServerError)
+	time.Sleep(40 * time.Millisecond)
+	value, found, err := resolver.Get(ctx, "partner-a", "API_TOKEN")
+	if err != nil || !found || value != "v1" {
+		t.Fatalf("Get() on refresh failure = %q, %v, %v; want stale v1", value, found, err)
+	}
+
+	// 没有旧值时返回错误
+	if _, _, err := resolver.Get(ctx, "partner-a", "OTHER"); err == nil {
+		t.Fatal("Get() without a cached value on failure succeeded, want error")
+	}
+}
+
+// mapProvider 测试用的内存密钥来源
+type mapProvider map[string]string
+
+func (p mapProvider) Name() string { return "map" }
+
+func (p mapProvider) Get(_ context.Context, partnerID, name string) (string, bool, error) {
+	value, ok := p[partnerID+"/"+name]
+	return value, ok, nil
+}
+
+func TestResolverTaskSecretsIgnoreProviderList(t *testing.T) {
+	// 来源配置不包含db时，任务敏感头密钥仍从合作方密钥库读取
+	taskSecrets := mapProvider{"partner-a/" + TaskSecretName("task_1_ab12", "Authorization"): "Bearer real"}
+	resolver := NewResolver(logging.New("error"), time.Minute, mapProvider{"partner-a/API_KEY": "env-key"})
+	resolver.SetTaskSecrets(taskSecrets)
+	ctx := context.Background()
+
+	name := TaskSecretName("task_1_ab12", "Authorization")
+	value, found, err := resolver.GetForTask(ctx, "partner-a", "task_1_ab12", name)
+	if err != nil || !found || value != "Bearer real" {
+		t.Fatalf("GetForTask(task secret) = %q, %v, %v; want Bearer real", value, found, err)
+	}
+	value, found, err = resolver.GetForTask(ctx, "partner-a", "task_1_ab12", "API_KEY")
+	if err != nil || !found || value != "env-key" {
+		t.Fatalf("GetForTask(API_KEY) = %q, %v, %v; want env-key", value, found, err)
+	}
+	// 普通密钥名不从合作方密钥库读取
+	taskSecrets["partner-a/OTHER"] = "db-only"
+	if _, found, _ := resolver.GetForTask(ctx, "partner-a", "task_1_ab12", "OTHER"); found {
+		t.Fatal("GetForTask(OTHER) resolved a non-task secret from the task secret store")
+	}
+}
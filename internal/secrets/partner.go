@@ -0,0 +1,140 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"api-notify/internal/core"
+	"api-notify/internal/store"
+)
+
+// ErrNoMasterKey 未配置主密钥，不能保存或读取合作方密钥
+var ErrNoMasterKey = errors.New("secrets master key is not configured")
+
+// namePattern 密钥名称格式，与派发器识别的占位符一致
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.\-]{1,64}$`)
+
+// PartnerSecrets 按合作方隔离的密钥库，密钥值以主密钥加密后保存在数据库中
+// 每个密文以合作方ID和密钥名作为附加数据，密文被复制到其他合作方名下时无法解密
+type PartnerSecrets struct {
+	store  *store.Store
+	cipher *Cipher
+	// onChange 密钥被修改或删除后调用（如清除本实例的密钥缓存）
+	onChange func(partnerID, name string)
+}
+
+// NewPartnerSecrets 创建合作方密钥库，cipher为nil时只能列出和删除密钥
+func NewPartnerSecrets(st *store.Store, cipher *Cipher) *PartnerSecrets {
+	return &PartnerSecrets{store: st, cipher: cipher}
+}
+
+// OnChange 设置密钥被修改或删除后的回调
+func (p *PartnerSecrets) OnChange(fn func(partnerID, name string)) {
+	p.onChange = fn
+}
+
+// notify 通知密钥变化
+func (p *PartnerSecrets) notify(partnerID, name string) {
+	if p.onChange != nil {
+		p.onChange(partnerID, name)
+	}
+}
+
+// ValidateName 校验密钥名称
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("secret name must match %s", namePattern.String())
+	}
+	return nil
+}
+
+// Put 加密并保存合作方密钥，同名密钥被替换
+func (p *PartnerSecrets) Put(ctx context.Context, partnerID, name, value string) error {
+	if p.cipher == nil {
+		return ErrNoMasterKey
+	}
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	ciphertext, err := p.cipher.Seal([]byte(value), additionalData(partnerID, name))
+	if err != nil {
+		return err
+	}
+
+	if err := p.store.SavePartnerSecret(ctx, &core.PartnerSecret{
+		PartnerID:  partnerID,
+		Name:       name,
+		Ciphertext: ciphertext,
+	}); err != nil {
+		return err
+	}
+
+	p.notify(partnerID, name)
+	return nil
+}
+
+// Get 读取并解密合作方密钥，不存在时返回false
+func (p *PartnerSecrets) Get(ctx context.Context, partnerID, name string) (string, bool, error) {
+	if p.cipher == nil {
+		return "", false, nil
+	}
+
+	secret, err := p.store.GetPartnerSecret(ctx, partnerID, name)
+	if err != nil {
+		return "", false, err
+	}
+	if secret == nil {
+		return "", false, nil
+	}
+
+	plaintext, err := p.cipher.Open(secret.Ciphertext, additionalData(partnerID, name))
+	if err != nil {
+		return "", false, fmt.Errorf("partner %s secret %s: %w", partnerID, name, err)
+	}
+	return string(plaintext), true, nil
+}
+
+// List 列出合作方的密钥（不含密钥值）
+func (p *PartnerSecrets) List(ctx context.Context, partnerID string) ([]*core.PartnerSecret, error) {
+	return p.store.ListPartnerSecrets(ctx, partnerID)
+}
+
+// Delete 删除合作方密钥，返回是否找到该密钥
+func (p *PartnerSecrets) Delete(ctx context.Context, partnerID, name string) (bool, error) {
+	found, err := p.store.DeletePartnerSecret(ctx, partnerID, name)
+	if err != nil {
+		return false, err
+	}
+
+	p.notify(partnerID, name)
+	return found, nil
+}
+
+// TaskSecretName 返回任务敏感头对应的密钥名称：任务ID_头名称（大写，-替换为_），如 task_1_ab12_AUTHORIZATION
+// 密钥只属于该任务，不会被同一合作方的其他任务覆盖
+func TaskSecretName(taskID, header string) string {
+	return taskSecretPrefix(taskID) + strings.ToUpper(strings.ReplaceAll(header, "-", "_"))
+}
+
+// taskSecretPrefix 任务密钥名称前缀
+func taskSecretPrefix(taskID string) string {
+	return taskID + "_"
+}
+
+// DeleteTaskSecrets 删除任务创建时保存的敏感头密钥，任务到达终态后调用
+// 本实例缓存中的旧值不会再被使用（任务不再派发），因此不清除缓存
+func DeleteTaskSecrets(ctx context.Context, st *store.Store, partnerID, taskID string) error {
+	if _, err := st.DeletePartnerSecretsByPrefix(ctx, partnerID, taskSecretPrefix(taskID)); err != nil {
+		return fmt.Errorf("failed to delete secrets of task %s: %w", taskID, err)
+	}
+	return nil
+}
+
+// additionalData 密文的附加数据：合作方ID和密钥名
+func additionalData(partnerID, name string) []byte {
+	return []byte(partnerID + "\x00" + name)
+}
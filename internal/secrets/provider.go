@@ -0,0 +1,151 @@
+package secrets
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"api-notify/pkg/logging"
+)
+
+// Provider 占位符密钥的来源
+// 来源按合作方隔离：Get只返回指定合作方名下的密钥
+type Provider interface {
+	// Name 来源名称，用于日志
+	Name() string
+	// Get 查找合作方的密钥，不存在时返回false
+	Get(ctx context.Context, partnerID, name string) (string, bool, error)
+}
+
+// Name 来源名称
+func (p *PartnerSecrets) Name() string { return "db" }
+
+// StaticProvider 运维配置的固定密钥（配置文件中的SensitiveHeaders），对所有合作方生效
+type StaticProvider struct {
+	values map[string]string
+}
+
+// NewStaticProvider 创建固定密钥来源
+func NewStaticProvider(values map[string]string) *StaticProvider {
+	return &StaticProvider{values: values}
+}
+
+// Name 来源名称
+func (p *StaticProvider) Name() string { return "config" }
+
+// Get 查找密钥，兼容以占位符本身（{{NAME}}）为键的配置，如AUTH_PLACEHOLDER
+func (p *StaticProvider) Get(_ context.Context, _ string, name string) (string, bool, error) {
+	if value, ok := p.values[name]; ok {
+		return value, true, nil
+	}
+	value, ok := p.values["{{"+name+"}}"]
+	return value, ok, nil
+}
+
+// cacheEntry 缓存的查找结果（包括未找到）
+type cacheEntry struct {
+	value     string
+	found     bool
+	expiresAt time.Time
+}
+
+// Resolver 按顺序从多个来源查找密钥，结果缓存ttl时间
+// 缓存过期后重新读取；读取失败时若有旧值则继续使用旧值，避免密钥服务短暂故障影响派发
+type Resolver struct {
+	providers []Provider
+	ttl       time.Duration
+	logger    *logging.Logger
+	// taskSecrets 创建任务时保存的敏感头密钥所在的合作方密钥库，不受来源配置影响
+	taskSecrets Provider
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+// NewResolver 创建密钥解析器，ttl为0时不缓存
+func NewResolver(logger *logging.Logger, ttl time.Duration, providers ...Provider) *Resolver {
+	return &Resolver{
+		providers: providers,
+		ttl:       ttl,
+		logger:    logger,
+		cache:     make(map[string]cacheEntry),
+	}
+}
+
+// SetTaskSecrets 设置任务敏感头密钥的来源（合作方密钥库）
+func (r *Resolver) SetTaskSecrets(provider Provider) {
+	r.taskSecrets = provider
+}
+
+// GetForTask 查找任务引用的密钥
+// 创建任务时保存的敏感头密钥（任务ID_头名称）只存在于合作方密钥库，无论来源配置是否包含db都从密钥库读取；
+// 其他密钥依次询问各来源
+func (r *Resolver) GetForTask(ctx context.Context, partnerID, taskID, name string) (string, bool, error) {
+	if r.taskSecrets != nil && strings.HasPrefix(name, taskSecretPrefix(taskID)) {
+		return r.get(ctx, partnerID, name, r.taskSecrets.Get)
+	}
+	return r.Get(ctx, partnerID, name)
+}
+
+// Get 查找合作方的密钥，依次询问各来源，返回第一个找到的值
+func (r *Resolver) Get(ctx context.Context, partnerID, name string) (string, bool, error) {
+	return r.get(ctx, partnerID, name, r.lookup)
+}
+
+// get 从缓存或lookup查找密钥，lookup失败时使用缓存中的旧值
+func (r *Resolver) get(ctx context.Context, partnerID, name string, lookup func(ctx context.Context, partnerID, name string) (string, bool, error)) (string, bool, error) {
+	key := partnerID + "\x00" + name
+
+	r.mu.Lock()
+	entry, cached := r.cache[key]
+	r.mu.Unlock()
+	if cached && time.Now().Before(entry.expiresAt) {
+		return entry.value, entry.found, nil
+	}
+
+	value, found, err := lookup(ctx, partnerID, name)
+	if err != nil {
+		if cached && entry.found {
+			r.logger.Warn("Failed to refresh secret %s for partner %s, using cached value: %v", name, partnerID, err)
+			return entry.value, true, nil
+		}
+		return "", false, err
+	}
+
+	if r.ttl > 0 {
+		r.mu.Lock()
+		r.cache[key] = cacheEntry{value: value, found: found, expiresAt: time.Now().Add(r.ttl)}
+		r.mu.Unlock()
+	}
+	return value, found, nil
+}
+
+// lookup 依次询问各来源
+func (r *Resolver) lookup(ctx context.Context, partnerID, name string) (string, bool, error) {
+	for _, provider := range r.providers {
+		value, found, err := provider.Get(ctx, partnerID, name)
+		if err != nil {
+			return "", false, err
+		}
+		if found {
+			r.logger.Debug("Secret %s for partner %s resolved from %s", name, partnerID, provider.Name())
+			return value, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Invalidate 清除合作方某个密钥的缓存，本实例修改密钥后调用
+func (r *Resolver) Invalidate(partnerID, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cache, partnerID+"\x00"+name)
+}
+
+// Purge 清除全部缓存，来源内容整体变化（如密钥目录更新）时调用
+func (r *Resolver) Purge() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = make(map[string]cacheEntry)
+}
@@ -0,0 +1,370 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"api-notify/internal/config"
+	"api-notify/pkg/httpclient"
+)
+
+// ErrTargetNotAllowed 目标URL不符合出站策略
+var ErrTargetNotAllowed = errors.New("target not allowed by policy")
+
+// Rule 一条目标匹配规则
+// 字符串形式为 [scheme://]host[:port][/path-prefix]，其中：
+//   - host 可以是精确主机名（example.com）、子域名通配（*.example.com，不含example.com本身）、
+//     CIDR网段（10.0.0.0/8，匹配IP字面量主机）或*（任意主机）
+//   - scheme 和 port 省略或为*时不限制
+//   - path-prefix 按解码后的路径段匹配，/hooks 匹配 /hooks 和 /hooks/a，不匹配 /hooksx
+//
+// 主机名不区分大小写并忽略末尾的点（evil.com. 与 evil.com 相同）
+type Rule struct {
+	Scheme     string
+	Host       string
+	Wildcard   bool // 为true时Host为子域名通配的后缀（不含前导*.）
+	AnyHost    bool
+	CIDR       *net.IPNet
+	Port       string
+	PathPrefix string
+}
+
+// ParseRule 解析规则字符串
+func ParseRule(raw string) (Rule, error) {
+	var rule Rule
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return rule, fmt.Errorf("empty rule")
+	}
+
+	if idx := strings.Index(s, "://"); idx != -1 {
+		rule.Scheme = strings.ToLower(s[:idx])
+		if rule.Scheme == "*" {
+			rule.Scheme = ""
+		}
+		s = s[idx+3:]
+	}
+
+	// CIDR规则不含端口和路径
+	if _, ipNet, err := net.ParseCIDR(s); err == nil {
+		rule.CIDR = ipNet
+		return rule, nil
+	}
+
+	hostPort := s
+	if idx := strings.Index(s, "/"); idx != -1 {
+		hostPort = s[:idx]
+		prefix, err := url.PathUnescape(strings.TrimSuffix(s[idx:], "/"))
+		if err != nil {
+			return rule, fmt.Errorf("invalid path in rule %q", raw)
+		}
+		rule.PathPrefix = prefix
+	}
+
+	host := hostPort
+	if h, p, err := net.SplitHostPort(hostPort); err == nil {
+		host = h
+		if p != "*" {
+			if _, err := strconv.Atoi(p); err != nil {
+				return rule, fmt.Errorf("invalid port in rule %q", raw)
+			}
+			rule.Port = p
+		}
+	}
+
+	host = normalizeHost(host)
+	switch {
+	case host == "*":
+		rule.AnyHost = true
+	case strings.HasPrefix(host, "*"):
+		// 兼容旧写法 *example.com，统一按子域名通配处理
+		rule.Wildcard = true
+		rule.Host = strings.TrimPrefix(strings.TrimPrefix(host, "*"), ".")
+	default:
+		if ip := net.ParseIP(host); ip != nil {
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			rule.CIDR = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		} else {
+			rule.Host = host
+		}
+	}
+
+	if rule.Host == "" && !rule.AnyHost && rule.CIDR == nil {
+		return rule, fmt.Errorf("invalid host in rule %q", raw)
+	}
+
+	return rule, nil
+}
+
+// Match 判断URL是否匹配规则
+func (r Rule) Match(target *url.URL) bool {
+	return r.matchHost(target, normalizeHost(target.Hostname()))
+}
+
+// matchHost 使用指定的主机判断URL是否匹配规则（mailto目标使用收件人域名）
+func (r Rule) matchHost(target *url.URL, host string) bool {
+	if r.Scheme != "" && r.Scheme != strings.ToLower(target.Scheme) {
+		return false
+	}
+	if r.Port != "" && r.Port != effectivePort(target) {
+		return false
+	}
+	if r.PathPrefix != "" {
+		path := target.Path
+		if path != r.PathPrefix && !strings.HasPrefix(path, r.PathPrefix+"/") {
+			return false
+		}
+	}
+
+	switch {
+	case r.AnyHost:
+		return true
+	case r.CIDR != nil:
+		ip := net.ParseIP(host)
+		return ip != nil && r.CIDR.Contains(ip)
+	case r.Wildcard:
+		return strings.HasSuffix(host, "."+r.Host)
+	default:
+		return host == r.Host
+	}
+}
+
+// Policy 出站目标策略
+// 评估顺序：协议 → 端口 → 拒绝列表（全局+合作方）→ 允许列表（合作方配置了则使用合作方的，否则使用全局的）
+// mailto目标对每个收件人域名评估（不检查端口），http+unix目标只允许显式配置的套接字
+type Policy struct {
+	schemes     map[string]bool
+	ports       map[string]bool
+	unixSockets map[string]bool
+	allow       []Rule
+	deny        []Rule
+	partners    map[string]partnerRules
+}
+
+// partnerRules 合作方专属规则
+type partnerRules struct {
+	allow []Rule
+	deny  []Rule
+}
+
+// NewPolicy 根据配置构建出站策略
+func NewPolicy(cfg *config.Config) (*Policy, error) {
+	p := &Policy{
+		schemes:     make(map[string]bool),
+		ports:       make(map[string]bool),
+		unixSockets: make(map[string]bool),
+		partners:    make(map[string]partnerRules),
+	}
+
+	for _, scheme := range cfg.Security.AllowedSchemes {
+		p.schemes[strings.ToLower(scheme)] = true
+	}
+	for _, port := range cfg.Security.AllowedPorts {
+		p.ports[strconv.Itoa(port)] = true
+	}
+	for _, socketPath := range cfg.Security.AllowedUnixSockets {
+		p.unixSockets[socketPath] = true
+	}
+
+	var err error
+	if p.allow, err = parseRules(cfg.Security.AllowedDomains); err != nil {
+		return nil, err
+	}
+	if p.deny, err = parseRules(cfg.Security.DeniedTargets); err != nil {
+		return nil, err
+	}
+
+	for partnerID, partner := range cfg.Partners {
+		var rules partnerRules
+		if rules.allow, err = parseRules(partner.AllowedTargets); err != nil {
+			return nil, fmt.Errorf("partner %s: %w", partnerID, err)
+		}
+		if rules.deny, err = parseRules(partner.DeniedTargets); err != nil {
+			return nil, fmt.Errorf("partner %s: %w", partnerID, err)
+		}
+		p.partners[partnerID] = rules
+	}
+
+	return p, nil
+}
+
+// CheckURL 检查合作方的目标URL字符串是否被允许
+func (p *Policy) CheckURL(partnerID, targetURL string) error {
+	parsedURL, err := url.Parse(targetURL)
+	if err != nil {
+		return fmt.Errorf("%w: failed to parse URL: %v", ErrTargetNotAllowed, err)
+	}
+	return p.Check(partnerID, parsedURL)
+}
+
+// Check 检查合作方的目标URL是否被允许，返回nil表示允许
+func (p *Policy) Check(partnerID string, target *url.URL) error {
+	scheme := strings.ToLower(target.Scheme)
+	if len(p.schemes) > 0 && !p.schemes[scheme] {
+		return fmt.Errorf("%w: scheme %q not allowed", ErrTargetNotAllowed, target.Scheme)
+	}
+
+	switch scheme {
+	case httpclient.SchemeHTTPUnix:
+		return p.checkUnixSocket(target)
+	case "mailto":
+		return p.checkMailto(partnerID, target)
+	}
+
+	host := normalizeHost(target.Hostname())
+	if host == "" {
+		return fmt.Errorf("%w: missing host", ErrTargetNotAllowed)
+	}
+	// 路径前缀规则按解码后的路径匹配，含.或..段的路径可能被接收方归一化到规则以外的路径，直接拒绝
+	if hasDotSegment(target.Path) {
+		return fmt.Errorf("%w: path contains dot segments", ErrTargetNotAllowed)
+	}
+	if len(p.ports) > 0 && !p.ports[effectivePort(target)] {
+		return fmt.Errorf("%w: port %s not allowed", ErrTargetNotAllowed, effectivePort(target))
+	}
+
+	return p.checkHost(partnerID, target, host)
+}
+
+// checkMailto 检查mailto目标的每个收件人域名
+func (p *Policy) checkMailto(partnerID string, target *url.URL) error {
+	recipients, err := MailtoRecipients(target)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTargetNotAllowed, err)
+	}
+	for _, address := range recipients {
+		domain := normalizeHost(address[strings.LastIndex(address, "@")+1:])
+		if err := p.checkHost(partnerID, target, domain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkUnixSocket 检查http+unix目标的套接字是否在允许列表中
+func (p *Policy) checkUnixSocket(target *url.URL) error {
+	socketPath, _, err := httpclient.ParseUnixURL(target.String())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTargetNotAllowed, err)
+	}
+	if !p.unixSockets[socketPath] {
+		return fmt.Errorf("%w: unix socket %s not allowed", ErrTargetNotAllowed, socketPath)
+	}
+	return nil
+}
+
+// checkHost 按拒绝列表和允许列表检查主机
+func (p *Policy) checkHost(partnerID string, target *url.URL, host string) error {
+	partner := p.partners[partnerID]
+	for _, rules := range [][]Rule{p.deny, partner.deny} {
+		for _, rule := range rules {
+			if rule.matchHost(target, host) {
+				return fmt.Errorf("%w: %s matches deny list", ErrTargetNotAllowed, host)
+			}
+		}
+	}
+
+	allow := p.allow
+	if len(partner.allow) > 0 {
+		allow = partner.allow
+	}
+
+	// 未配置允许列表或允许任意主机
+	if len(allow) == 0 || (len(allow) == 1 && allow[0].AnyHost && allow[0].Scheme == "" && allow[0].Port == "" && allow[0].PathPrefix == "") {
+		return nil
+	}
+
+	for _, rule := range allow {
+		if !rule.matchHost(target, host) {
+			continue
+		}
+		// IP字面量只能由显式的CIDR规则放行非公网地址
+		if ip := net.ParseIP(host); ip != nil && rule.CIDR == nil && !isPublicIP(ip) {
+			continue
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s not in allow list", ErrTargetNotAllowed, target.Redacted())
+}
+
+// MailtoRecipients 解析mailto URL中的收件人地址（逗号分隔）
+func MailtoRecipients(target *url.URL) ([]string, error) {
+	raw := target.Opaque
+	if raw == "" {
+		raw = target.Path
+	}
+	raw, err := url.PathUnescape(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mailto address: %w", err)
+	}
+	if raw == "" {
+		return nil, fmt.Errorf("missing mailto recipient")
+	}
+
+	addresses, err := mail.ParseAddressList(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mailto address: %w", err)
+	}
+	recipients := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		recipients = append(recipients, address.Address)
+	}
+	return recipients, nil
+}
+
+// parseRules 解析规则列表
+func parseRules(raw []string) ([]Rule, error) {
+	rules := make([]Rule, 0, len(raw))
+	for _, s := range raw {
+		rule, err := ParseRule(s)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// normalizeHost 主机名转为小写并去掉末尾的点，使 Evil.com. 与 evil.com 按同一主机匹配
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// hasDotSegment 判断解码后的路径是否包含.或..段（如 /hooks/../admin、/hooks/%2e%2e/admin）
+func hasDotSegment(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// effectivePort 获取URL的端口，未显式指定时按协议取默认端口
+func effectivePort(target *url.URL) string {
+	if port := target.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(target.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+// isPublicIP 是否为公网地址
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast())
+}
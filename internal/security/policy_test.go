@@ -0,0 +1,94 @@
+package security
+
+import (
+	"errors"
+	"testing"
+
+	"api-notify/internal/config"
+)
+
+// newTestPolicy 使用指定的全局允许和拒绝规则创建策略
+func newTestPolicy(t *testing.T, allow, deny []string) *Policy {
+	t.Helper()
+	cfg := &config.Config{}
+	cfg.Security.AllowedSchemes = []string{"http", "https", "mailto"}
+	cfg.Security.AllowedDomains = allow
+	cfg.Security.DeniedTargets = deny
+	policy, err := NewPolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestPolicyTrailingDotHost(t *testing.T) {
+	policy := newTestPolicy(t, nil, []string{"evil.com", "*.bad.org"})
+
+	for _, target := range []string{
+		"https://evil.com/hook",
+		"https://evil.com./hook",
+		"https://EVIL.COM./hook",
+		"https://x.bad.org/hook",
+		"https://x.bad.org./hook",
+		"mailto:ops@evil.com.",
+	} {
+		if err := policy.CheckURL("", target); !errors.Is(err, ErrTargetNotAllowed) {
+			t.Errorf("CheckURL(%s) = %v, want denied", target, err)
+		}
+	}
+	if err := policy.CheckURL("", "https://good.com./hook"); err != nil {
+		t.Errorf("CheckURL(good.com.) = %v, want allowed", err)
+	}
+}
+
+func TestPolicyTrailingDotAllowRule(t *testing.T) {
+	policy := newTestPolicy(t, []string{"hooks.example.com", "*.partner.test"}, nil)
+
+	for _, target := range []string{
+		"https://hooks.example.com./a",
+		"https://api.partner.test./a",
+	} {
+		if err := policy.CheckURL("", target); err != nil {
+			t.Errorf("CheckURL(%s) = %v, want allowed", target, err)
+		}
+	}
+}
+
+func TestPolicyPathPrefixDotSegments(t *testing.T) {
+	allowOnly := newTestPolicy(t, []string{"https://hooks.example.com/hooks"}, nil)
+	denyAdmin := newTestPolicy(t, nil, []string{"https://hooks.example.com/admin"})
+
+	bypasses := []string{
+		"https://hooks.example.com/hooks/../admin",
+		"https://hooks.example.com/hooks/%2e%2e/admin",
+		"https://hooks.example.com/hooks/%2E%2E/admin",
+		"https://hooks.example.com/hooks/./../admin",
+		"https://hooks.example.com/hooks%2f..%2fadmin",
+	}
+	for _, target := range bypasses {
+		if err := allowOnly.CheckURL("", target); !errors.Is(err, ErrTargetNotAllowed) {
+			t.Errorf("allow /hooks: CheckURL(%s) = %v, want denied", target, err)
+		}
+		if err := denyAdmin.CheckURL("", target); !errors.Is(err, ErrTargetNotAllowed) {
+			t.Errorf("deny /admin: CheckURL(%s) = %v, want denied", target, err)
+		}
+	}
+
+	// 编码后的路径按解码结果匹配拒绝规则
+	if err := denyAdmin.CheckURL("", "https://hooks.example.com/%61dmin/x"); !errors.Is(err, ErrTargetNotAllowed) {
+		t.Errorf("deny /admin: CheckURL(/%%61dmin/x) = %v, want denied", err)
+	}
+
+	for _, target := range []string{
+		"https://hooks.example.com/hooks",
+		"https://hooks.example.com/hooks/order..paid",
+		"https://hooks.example.com/hooks/a",
+	} {
+		if err := allowOnly.CheckURL("", target); err != nil {
+			t.Errorf("allow /hooks: CheckURL(%s) = %v, want allowed", target, err)
+		}
+	}
+	if err := allowOnly.CheckURL("", "https://hooks.example.com/hooksx"); !errors.Is(err, ErrTargetNotAllowed) {
+		t.Errorf("allow /hooks: CheckURL(/hooksx) = %v, want denied", err)
+	}
+}
@@ -0,0 +1,124 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+)
+
+// HeaderWebhookKeyID 标识Ed25519签名所用公钥的请求头，接收方据此在JWKS中查找公钥
+const HeaderWebhookKeyID = "webhook-key-id"
+
+// Ed25519Key 一个Ed25519签名密钥
+type Ed25519Key struct {
+	KeyID      string
+	PrivateKey ed25519.PrivateKey
+}
+
+// Ed25519Keyring Ed25519密钥环
+// 所有密钥的公钥都会发布在JWKS中，仅活动密钥用于签名；
+// 轮换时先加入新密钥使其公钥被接收方缓存，再切换活动密钥，最后移除旧密钥
+type Ed25519Keyring struct {
+	keys   []Ed25519Key
+	active *Ed25519Key
+}
+
+// JWK 公钥的JSON Web Key表示
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+// JWKSet JSON Web Key Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewEd25519Keyring 创建密钥环，activeKeyID为空时使用第一个密钥签名
+func NewEd25519Keyring(keys []Ed25519Key, activeKeyID string) (*Ed25519Keyring, error) {
+	keyring := &Ed25519Keyring{keys: keys}
+	if len(keys) == 0 {
+		return keyring, nil
+	}
+
+	if activeKeyID == "" {
+		keyring.active = &keyring.keys[0]
+		return keyring, nil
+	}
+	for i := range keyring.keys {
+		if keyring.keys[i].KeyID == activeKeyID {
+			keyring.active = &keyring.keys[i]
+			return keyring, nil
+		}
+	}
+	return nil, fmt.Errorf("active ed25519 key %q not found", activeKeyID)
+}
+
+// LoadEd25519Key 从PKCS#8 PEM文件加载Ed25519私钥
+func LoadEd25519Key(keyID, path string) (Ed25519Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Ed25519Key{}, fmt.Errorf("failed to read ed25519 key %s: %w", keyID, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Ed25519Key{}, fmt.Errorf("invalid PEM in ed25519 key %s", keyID)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return Ed25519Key{}, fmt.Errorf("failed to parse ed25519 key %s: %w", keyID, err)
+	}
+
+	privateKey, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return Ed25519Key{}, fmt.Errorf("key %s is not an ed25519 private key", keyID)
+	}
+
+	return Ed25519Key{KeyID: keyID, PrivateKey: privateKey}, nil
+}
+
+// CanSign 密钥环中是否有可用于签名的密钥
+func (k *Ed25519Keyring) CanSign() bool {
+	return k != nil && k.active != nil
+}
+
+// Sign 使用活动密钥签名，返回密钥ID和webhook-signature头的值（v1a,<base64>）
+func (k *Ed25519Keyring) Sign(msgID string, timestamp time.Time, body []byte) (string, string, error) {
+	if !k.CanSign() {
+		return "", "", fmt.Errorf("no active ed25519 signing key")
+	}
+
+	signature := ed25519.Sign(k.active.PrivateKey, SignedContent(msgID, timestamp, body))
+	return k.active.KeyID, "v1a," + base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// JWKS 返回所有密钥的公钥集合
+func (k *Ed25519Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: make([]JWK, 0)}
+	if k == nil {
+		return set
+	}
+
+	for _, key := range k.keys {
+		publicKey := key.PrivateKey.Public().(ed25519.PublicKey)
+		set.Keys = append(set.Keys, JWK{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(publicKey),
+			KeyID:     key.KeyID,
+			Use:       "sig",
+			Algorithm: "EdDSA",
+		})
+	}
+	return set
+}
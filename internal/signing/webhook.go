@@ -0,0 +1,79 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Standard Webhooks 规范定义的请求头
+const (
+	HeaderWebhookID        = "webhook-id"
+	HeaderWebhookTimestamp = "webhook-timestamp"
+	HeaderWebhookSignature = "webhook-signature"
+)
+
+// secretPrefix 对称密钥的前缀
+const secretPrefix = "whsec_"
+
+// secretSize 新生成密钥的字节数
+const secretSize = 32
+
+// GenerateSecret 生成新的对称签名密钥，格式为 whsec_<base64>
+func GenerateSecret() (string, error) {
+	key := make([]byte, secretSize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return secretPrefix + base64.StdEncoding.EncodeToString(key), nil
+}
+
+// DecodeSecret 解析 whsec_<base64> 格式的密钥
+func DecodeSecret(secret string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, secretPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing secret: %w", err)
+	}
+	return key, nil
+}
+
+// SignedContent 构造待签名内容：{msgID}.{timestamp}.{body}
+func SignedContent(msgID string, timestamp time.Time, body []byte) []byte {
+	prefix := msgID + "." + strconv.FormatInt(timestamp.Unix(), 10) + "."
+	content := make([]byte, 0, len(prefix)+len(body))
+	content = append(content, prefix...)
+	return append(content, body...)
+}
+
+// SignHMAC 使用所有给定密钥计算HMAC-SHA256签名
+// 返回webhook-signature头的值，多个签名以空格分隔，接收方任一验证通过即可（用于密钥轮换）
+func SignHMAC(msgID string, timestamp time.Time, body []byte, secrets []string) (string, error) {
+	content := SignedContent(msgID, timestamp, body)
+
+	signatures := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		key, err := DecodeSecret(secret)
+		if err != nil {
+			return "", err
+		}
+		mac := hmac.New(sha256.New, key)
+		mac.Write(content)
+		signatures = append(signatures, "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	}
+
+	return strings.Join(signatures, " "), nil
+}
+
+// Headers 生成签名相关请求头
+func Headers(msgID string, timestamp time.Time, signature string) map[string]string {
+	return map[string]string{
+		HeaderWebhookID:        msgID,
+		HeaderWebhookTimestamp: strconv.FormatInt(timestamp.Unix(), 10),
+		HeaderWebhookSignature: signature,
+	}
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"api-notify/internal/blob"
+	"api-notify/internal/config"
+	"api-notify/internal/core"
+)
+
+// newBlobStore 按配置创建大请求体的blob存储，未配置后端时返回nil
+func newBlobStore(cfg *config.Config) (*blob.ContentStore, error) {
+	switch cfg.Blob.Backend {
+	case "":
+		return nil, nil
+	case "file":
+		if cfg.Blob.Dir == "" {
+			return nil, fmt.Errorf("blob backend file requires BLOB_DIR")
+		}
+		backend, err := blob.NewFileBackend(cfg.Blob.Dir)
+		if err != nil {
+			return nil, err
+		}
+		return blob.NewContentStore(backend), nil
+	case "s3":
+		backend, err := blob.NewS3Backend(blob.S3Config{
+			Endpoint:        cfg.Blob.S3.Endpoint,
+			Bucket:          cfg.Blob.S3.Bucket,
+			Region:          cfg.Blob.S3.Region,
+			AccessKeyID:     cfg.Blob.S3.AccessKeyID,
+			SecretAccessKey: cfg.Blob.S3.SecretAccessKey,
+			Prefix:          cfg.Blob.S3.Prefix,
+			Timeout:         cfg.Blob.S3.Timeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return blob.NewContentStore(backend), nil
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", cfg.Blob.Backend)
+	}
+}
+
+// offloadBody 请求体超过阈值时存入blob存储，行中只保留引用
+// 启用静态加密时存入的是密文，size为明文长度
+func (s *Store) offloadBody(ctx context.Context, sealed *sealedPayload, size int) error {
+	if s.blobs == nil || size <= s.blobThreshold {
+		return nil
+	}
+
+	// 相同内容共用一个对象：写入前先取消该引用的待回收记录，正在回收时等待回收结束后重新写入
+	data := []byte(sealed.body)
+	if err := s.unmarkOrphanBlob(ctx, s.blobs.Ref(data)); err != nil {
+		return err
+	}
+	ref, err := s.blobs.Put(ctx, data)
+	if err != nil {
+		return fmt.Errorf("failed to offload task body: %w", err)
+	}
+	sealed.body = ""
+	sealed.bodyRef = sql.NullString{String: ref, Valid: true}
+	return nil
+}
+
+// LoadTaskBody 加载保存在blob存储中的任务请求体，未存入blob存储时直接返回任务中的请求体
+// 重新读取行中当前的引用和密钥信息，读取任务后行被重新加密时也能正确解密
+func (s *Store) LoadTaskBody(ctx context.Context, task *core.NotificationTask) (string, error) {
+	if task.BodyRef == "" {
+		return task.Body, nil
+	}
+
+	query := `
+	SELECT body, COALESCE(body_ref, ''), COALESCE(key_id, ''), COALESCE(wrapped_key, '')
+	FROM notification_tasks WHERE task_id = ?
+	`
+	loaded := core.NotificationTask{TaskID: task.TaskID}
+	var keyID, wrappedKey string
+	err := s.db.QueryRowContext(ctx, query, task.TaskID).Scan(&loaded.Body, &loaded.BodyRef, &keyID, &wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to get task body ref: %w", err)
+	}
+
+	if loaded.BodyRef != "" {
+		if loaded.Body, err = s.getBlob(ctx, loaded.BodyRef); err != nil {
+			return "", err
+		}
+	}
+	if err := s.decryptPayload(&loaded, keyID, wrappedKey); err != nil {
+		return "", err
+	}
+	return loaded.Body, nil
+}
+
+// orphanBlobGracePeriod 待回收blob的等待时间，等待期间写入相同内容的任务已完成插入，回收时能看到其引用
+const orphanBlobGracePeriod = 10 * time.Minute
+
+// markOrphanBlob 记录可能已无任务引用的blob（任务插入失败、重新加密后替换了旧引用），由CollectOrphanBlobs回收
+// 只记录日志不返回错误：记录失败只会留下未回收的对象
+func (s *Store) markOrphanBlob(ctx context.Context, ref string) {
+	// 调用方的上下文可能已取消（如插入因请求取消而失败），记录仍需写入
+	ctx = context.WithoutCancel(ctx)
+	query := `
+	INSERT INTO orphan_blobs (ref, created_at) VALUES (?, ?)
+	ON DUPLICATE KEY UPDATE created_at = VALUES(created_at)
+	`
+	if _, err := s.db.ExecContext(ctx, query, ref, time.Now()); err != nil {
+		s.logger.Error("Failed to mark blob %s for collection: %v", ref, err)
+	}
+}
+
+// unmarkOrphanBlob 取消blob的待回收记录，该记录正被回收任务锁定时等待其完成
+func (s *Store) unmarkOrphanBlob(ctx context.Context, ref string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM orphan_blobs WHERE ref = ?", ref); err != nil {
+		return fmt.Errorf("failed to unmark blob %s: %w", ref, err)
+	}
+	return nil
+}
+
+// CollectOrphanBlobs 删除待回收记录中已超过等待时间且没有任务引用的blob，返回删除的对象数
+// 每个引用在事务中锁定待回收记录后检查引用并删除对象，与写入相同内容的任务互斥
+func (s *Store) CollectOrphanBlobs(ctx context.Context, batchSize int) (int, error) {
+	if s.blobs == nil {
+		return 0, nil
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	query := `
+	SELECT ref FROM orphan_blobs
+	WHERE created_at < ?
+	ORDER BY created_at ASC
+	LIMIT ?
+	`
+	rows, err := s.db.QueryContext(ctx, query, time.Now().Add(-orphanBlobGracePeriod), batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query orphan blobs: %w", err)
+	}
+	var refs []string
+	for rows.Next() {
+		var ref string
+		if err := rows.Scan(&ref); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan orphan blob: %w", err)
+		}
+		refs = append(refs, ref)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	deleted := 0
+	for _, ref := range refs {
+		removed, err := s.collectOrphanBlob(ctx, ref)
+		if err != nil {
+			s.logger.Error("Failed to collect blob %s: %v", ref, err)
+			continue
+		}
+		if removed {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// collectOrphanBlob 回收单个blob，仍被任务引用时只删除待回收记录
+func (s *Store) collectOrphanBlob(ctx context.Context, ref string) (bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var locked string
+	err = tx.QueryRowContext(ctx, "SELECT ref FROM orphan_blobs WHERE ref = ? FOR UPDATE", ref).Scan(&locked)
+	if errors.Is(err, sql.ErrNoRows) {
+		// 已被写入相同内容的任务取消
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock orphan blob: %w", err)
+	}
+
+	var references int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM notification_tasks WHERE body_ref = ?", ref).Scan(&references); err != nil {
+		return false, fmt.Errorf("failed to count blob references: %w", err)
+	}
+	if references == 0 {
+		if err := s.blobs.Delete(ctx, ref); err != nil {
+			return false, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM orphan_blobs WHERE ref = ?", ref); err != nil {
+		return false, fmt.Errorf("failed to delete orphan blob record: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit orphan blob collection: %w", err)
+	}
+	return references == 0, nil
+}
+
+// getBlob 读取blob存储中的请求体
+func (s *Store) getBlob(ctx context.Context, ref string) (string, error) {
+	if s.blobs == nil {
+		return "", fmt.Errorf("task body %s is in the blob store but no blob store is configured", ref)
+	}
+	data, err := s.blobs.Get(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
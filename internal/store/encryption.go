@@ -0,0 +1,256 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"api-notify/internal/blob"
+	"api-notify/internal/core"
+	"api-notify/internal/envelope"
+)
+
+// sealedPayload 写入数据库的任务请求头、请求体和模板数据，未启用加密时为明文且key_id为NULL
+// 请求体存入blob存储后body为空，bodyRef为blob引用
+type sealedPayload struct {
+	headers      string
+	body         string
+	templateData string
+	keyID        sql.NullString
+	wrappedKey   sql.NullString
+	bodyRef      sql.NullString
+}
+
+// payloadAAD 加密任务字段时绑定的附加数据，密文不能被复制到其他任务或其他列
+func payloadAAD(taskID, column string) []byte {
+	return []byte(taskID + "\x00" + column)
+}
+
+// encryptPayload 为任务生成数据密钥并加密请求头、请求体和模板数据，空值不加密
+func (s *Store) encryptPayload(task *core.NotificationTask) (*sealedPayload, error) {
+	if s.keyring == nil {
+		return &sealedPayload{headers: task.Headers, body: task.Body, templateData: task.TemplateData}, nil
+	}
+
+	dataKey, err := s.keyring.NewDataKey(payloadAAD(task.TaskID, "data_key"))
+	if err != nil {
+		return nil, err
+	}
+	return sealPayload(dataKey, task.TaskID, task.Headers, task.Body, task.TemplateData)
+}
+
+// sealPayload 使用数据密钥加密请求头、请求体和模板数据
+func sealPayload(dataKey *envelope.DataKey, taskID, headers, body, templateData string) (*sealedPayload, error) {
+	sealed := &sealedPayload{
+		keyID:      sql.NullString{String: dataKey.KeyID, Valid: true},
+		wrappedKey: sql.NullString{String: dataKey.Wrapped, Valid: true},
+	}
+	for _, field := range []struct {
+		column    string
+		plaintext string
+		target    *string
+	}{
+		{"headers", headers, &sealed.headers},
+		{"body", body, &sealed.body},
+		{"template_data", templateData, &sealed.templateData},
+	} {
+		if field.plaintext == "" {
+			continue
+		}
+		ciphertext, err := dataKey.Seal([]byte(field.plaintext), payloadAAD(taskID, field.column))
+		if err != nil {
+			return nil, err
+		}
+		*field.target = ciphertext
+	}
+	return sealed, nil
+}
+
+// decryptPayload 解密任务的请求头、请求体和模板数据，keyID为空表示该行为明文（启用加密前写入）
+func (s *Store) decryptPayload(task *core.NotificationTask, keyID, wrappedKey string) error {
+	if keyID == "" {
+		return nil
+	}
+	if s.keyring == nil {
+		return fmt.Errorf("task %s: %w: payload encryption keys are not configured", task.TaskID, envelope.ErrUnknownKey)
+	}
+
+	dataKey, err := s.keyring.OpenDataKey(keyID, wrappedKey, payloadAAD(task.TaskID, "data_key"))
+	if err != nil {
+		return fmt.Errorf("task %s: %w", task.TaskID, err)
+	}
+	for _, field := range []struct {
+		column string
+		value  *string
+	}{
+		{"headers", &task.Headers},
+		{"body", &task.Body},
+		{"template_data", &task.TemplateData},
+	} {
+		if *field.value == "" {
+			continue
+		}
+		plaintext, err := dataKey.Open(*field.value, payloadAAD(task.TaskID, field.column))
+		if err != nil {
+			return fmt.Errorf("task %s %s: %w", task.TaskID, field.column, err)
+		}
+		*field.value = string(plaintext)
+	}
+	return nil
+}
+
+// ReencryptTasks 将任务表中未使用当前密钥的行改用当前密钥：明文行加密，旧密钥包装的行只重新包装数据密钥
+// 按主键分批处理直到没有需要处理的行，返回处理的行数；使用旧密钥以外的未知密钥的行跳过
+func (s *Store) ReencryptTasks(ctx context.Context, batchSize int) (int, error) {
+	if s.keyring == nil {
+		return 0, nil
+	}
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	activeKeyID := s.keyring.ActiveKeyID()
+	query := `
+	SELECT id, task_id, headers, body, COALESCE(template_data, ''), COALESCE(key_id, ''), COALESCE(wrapped_key, ''), COALESCE(body_ref, '')
+	FROM notification_tasks
+	WHERE id > ? AND (key_id IS NULL OR key_id <> ?)
+	ORDER BY id ASC
+	LIMIT ?
+	`
+
+	var cursor uint64
+	processed := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return processed, err
+		}
+
+		rows, err := s.db.QueryContext(ctx, query, cursor, activeKeyID, batchSize)
+		if err != nil {
+			return processed, fmt.Errorf("failed to query tasks for re-encryption: %w", err)
+		}
+
+		type pendingRow struct {
+			id           uint64
+			taskID       string
+			headers      string
+			body         string
+			templateData string
+			keyID        string
+			wrappedKey   string
+			bodyRef      string
+		}
+		var batch []pendingRow
+		for rows.Next() {
+			var row pendingRow
+			if err := rows.Scan(&row.id, &row.taskID, &row.headers, &row.body, &row.templateData, &row.keyID, &row.wrappedKey, &row.bodyRef); err != nil {
+				rows.Close()
+				return processed, fmt.Errorf("failed to scan task for re-encryption: %w", err)
+			}
+			batch = append(batch, row)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return processed, fmt.Errorf("rows iteration error: %w", err)
+		}
+
+		for _, row := range batch {
+			cursor = row.id
+
+			var updated bool
+			if row.keyID == "" {
+				updated, err = s.encryptPlaintextTask(ctx, row.id, row.taskID, row.headers, row.body, row.templateData, row.bodyRef)
+			} else {
+				updated, err = s.rewrapTask(ctx, row.id, row.taskID, row.keyID, row.wrappedKey)
+			}
+			if errors.Is(err, envelope.ErrDecrypt) || errors.Is(err, blob.ErrNotFound) {
+				s.logger.Error("Skipping re-encryption of task %s: %v", row.taskID, err)
+				continue
+			}
+			if err != nil {
+				return processed, err
+			}
+			if updated {
+				processed++
+			}
+		}
+
+		if len(batch) < batchSize {
+			return processed, nil
+		}
+	}
+}
+
+// encryptPlaintextTask 加密启用加密前写入的明文行，期间行已被其他实例处理时不更新
+// 请求体在blob存储中时读取明文blob，加密后作为新的blob保存，旧的明文blob交给回收任务删除
+func (s *Store) encryptPlaintextTask(ctx context.Context, id uint64, taskID, headers, body, templateData, bodyRef string) (bool, error) {
+	if bodyRef != "" {
+		var err error
+		if body, err = s.getBlob(ctx, bodyRef); err != nil {
+			return false, err
+		}
+	}
+
+	dataKey, err := s.keyring.NewDataKey(payloadAAD(taskID, "data_key"))
+	if err != nil {
+		return false, err
+	}
+	sealed, err := sealPayload(dataKey, taskID, headers, body, templateData)
+	if err != nil {
+		return false, err
+	}
+	if err := s.offloadBody(ctx, sealed, len(body)); err != nil {
+		return false, err
+	}
+
+	query := `
+	UPDATE notification_tasks
+	SET headers = ?, body = ?, template_data = ?, key_id = ?, wrapped_key = ?, body_ref = ?
+	WHERE id = ? AND key_id IS NULL
+	`
+	result, err := s.db.ExecContext(ctx, query, sealed.headers, sealed.body, sealed.templateData, sealed.keyID, sealed.wrappedKey, sealed.bodyRef, id)
+	if err != nil {
+		if sealed.bodyRef.Valid {
+			s.markOrphanBlob(ctx, sealed.bodyRef.String)
+		}
+		return false, fmt.Errorf("failed to encrypt task %s: %w", taskID, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	// 更新成功时旧的明文blob不再被该任务引用，未更新时新写入的密文blob没有引用，均交给回收任务删除
+	switch {
+	case affected > 0 && bodyRef != "":
+		s.markOrphanBlob(ctx, bodyRef)
+	case affected == 0 && sealed.bodyRef.Valid:
+		s.markOrphanBlob(ctx, sealed.bodyRef.String)
+	}
+	return affected > 0, nil
+}
+
+// rewrapTask 用当前密钥重新包装数据密钥，各列的密文不变
+func (s *Store) rewrapTask(ctx context.Context, id uint64, taskID, keyID, wrappedKey string) (bool, error) {
+	dataKey, err := s.keyring.Rewrap(keyID, wrappedKey, payloadAAD(taskID, "data_key"))
+	if err != nil {
+		return false, err
+	}
+
+	query := `
+	UPDATE notification_tasks
+	SET key_id = ?, wrapped_key = ?
+	WHERE id = ? AND key_id = ? AND wrapped_key = ?
+	`
+	result, err := s.db.ExecContext(ctx, query, dataKey.KeyID, dataKey.Wrapped, id, keyID, wrappedKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to rewrap data key of task %s: %w", taskID, err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	return affected > 0, nil
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"api-notify/internal/core"
+)
+
+// TryAcquireLease 尝试获取或续约指定名称的租约
+// 租约不存在、已过期或已由holder持有时获取成功，时间以数据库时钟为准避免实例间时钟漂移
+func (s *Store) TryAcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	// 注意：MySQL按顺序求值赋值表达式，expires_at中的holder已是更新后的值
+	query := `
+	INSERT INTO leader_leases (name, holder, expires_at)
+	VALUES (?, ?, NOW(3) + INTERVAL ? MICROSECOND)
+	ON DUPLICATE KEY UPDATE
+		holder = IF(holder = VALUES(holder) OR expires_at < NOW(3), VALUES(holder), holder),
+		expires_at = IF(holder = VALUES(holder), VALUES(expires_at), expires_at)
+	`
+
+	if _, err := s.db.ExecContext(ctx, query, name, holder, ttl.Microseconds()); err != nil {
+		return false, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+
+	var current string
+	if err := s.db.QueryRowContext(ctx, "SELECT holder FROM leader_leases WHERE name = ?", name).Scan(&current); err != nil {
+		return false, fmt.Errorf("failed to get lease holder: %w", err)
+	}
+
+	return current == holder, nil
+}
+
+// ReleaseLease 释放由holder持有的租约，便于其他实例立即接管
+func (s *Store) ReleaseLease(ctx context.Context, name, holder string) error {
+	query := "DELETE FROM leader_leases WHERE name = ? AND holder = ?"
+
+	if _, err := s.db.ExecContext(ctx, query, name, holder); err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+
+	return nil
+}
+
+// ReapStaleTasks 将长时间停留在running状态的任务重置为pending
+// 用于回收实例崩溃后遗留的任务，返回被回收的任务数
+// 等待重试的任务同样处于running状态但下次尝试时间在未来，不回收，以免提前重试破坏退避间隔
+func (s *Store) ReapStaleTasks(ctx context.Context, staleAfter time.Duration) (int64, error) {
+	query := `
+	UPDATE notification_tasks 
+	SET status = ?, next_attempt_at = NOW() 
+	WHERE status = ? AND updated_at < NOW() - INTERVAL ? SECOND AND next_attempt_at <= NOW()
+	`
+
+	result, err := s.db.ExecContext(ctx, query, core.TaskStatusPending, core.TaskStatusRunning, int64(staleAfter.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to reap stale tasks: %w", err)
+	}
+
+	return result.RowsAffected()
+}
@@ -6,7 +6,9 @@ import (
 
 	_ "github.com/go-sql-driver/mysql"
 
+	"api-notify/internal/blob"
 	"api-notify/internal/config"
+	"api-notify/internal/envelope"
 	"api-notify/pkg/logging"
 )
 
@@ -14,10 +16,32 @@ import (
 type Store struct {
 	db     *sql.DB
 	logger *logging.Logger
+	// keyring 任务请求头和请求体的静态加密密钥，为nil时不加密
+	keyring *envelope.Keyring
+	// blobs 大请求体的blob存储，为nil时请求体始终保存在任务表中
+	blobs *blob.ContentStore
+	// blobThreshold 请求体超过该字节数时存入blob存储
+	blobThreshold int
 }
 
 // New 创建一个新的数据库存储实例
 func New(cfg *config.Config, logger *logging.Logger) (*Store, error) {
+	// 加载静态加密密钥
+	var keyring *envelope.Keyring
+	if len(cfg.Database.Encryption.Keys) > 0 {
+		var err error
+		keyring, err = envelope.NewKeyring(cfg.Database.Encryption.Keys, cfg.Database.Encryption.ActiveKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload encryption keys: %w", err)
+		}
+	}
+
+	// 创建大请求体的blob存储
+	blobs, err := newBlobStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blob store configuration: %w", err)
+	}
+
 	// 连接数据库
 	db, err := sql.Open("mysql", cfg.Database.DSN)
 	if err != nil {
@@ -42,8 +66,11 @@ func New(cfg *config.Config, logger *logging.Logger) (*Store, error) {
 	}
 
 	return &Store{
-		db:     db,
-		logger: logger,
+		db:            db,
+		logger:        logger,
+		keyring:       keyring,
+		blobs:         blobs,
+		blobThreshold: cfg.Blob.ThresholdBytes,
 	}, nil
 }
 
@@ -107,6 +134,209 @@ func initTables(db *sql.DB, logger *logging.Logger) error {
 		return fmt.Errorf("failed to create notification_attempts table: %w", err)
 	}
 
+	// 为已存在的尝试记录表补充新增列
+	attemptColumns := []columnDef{
+		{name: "redirect_chain", definition: "TEXT NULL"},
+		{name: "response_body", definition: "TEXT NULL"},
+		{name: "response_headers", definition: "TEXT NULL"},
+		{name: "dns_ms", definition: "BIGINT NOT NULL DEFAULT 0"},
+		{name: "connect_ms", definition: "BIGINT NOT NULL DEFAULT 0"},
+		{name: "tls_handshake_ms", definition: "BIGINT NOT NULL DEFAULT 0"},
+		{name: "ttfb_ms", definition: "BIGINT NOT NULL DEFAULT 0"},
+		{name: "transfer_ms", definition: "BIGINT NOT NULL DEFAULT 0"},
+		{name: "conn_reused", definition: "TINYINT(1) NOT NULL DEFAULT 0"},
+		{name: "remote_ip", definition: "VARCHAR(64) NULL"},
+		{name: "request_snapshot", definition: "TEXT NULL"},
+	}
+	if err := ensureColumns(db, "notification_attempts", attemptColumns); err != nil {
+		return err
+	}
+
+	// 补充通知任务表的新增列
+	taskColumns := []columnDef{
+		{name: "timeouts", definition: "TEXT NULL"},
+		{name: "event_type", definition: "VARCHAR(128) NULL"},
+		{name: "callback_url", definition: "VARCHAR(512) NULL"},
+		{name: "template_name", definition: "VARCHAR(64) NULL"},
+		{name: "template_data", definition: "MEDIUMTEXT NULL"},
+		{name: "body_encoding", definition: "VARCHAR(16) NULL"},
+		{name: "key_id", definition: "VARCHAR(64) NULL"},
+		{name: "wrapped_key", definition: "VARCHAR(255) NULL"},
+		{name: "body_ref", definition: "VARCHAR(128) NULL"},
+		{name: "expires_at", definition: "DATETIME NULL"},
+	}
+	if err := ensureColumns(db, "notification_tasks", taskColumns); err != nil {
+		return err
+	}
+	// 回收blob前按引用检查是否仍被任务使用
+	if err := ensureIndex(db, "notification_tasks", "idx_body_ref", "body_ref"); err != nil {
+		return err
+	}
+
+	// 创建待回收blob表（可能已无任务引用的blob，由领导者实例的回收任务确认后删除）
+	orphanBlobTableSQL := `
+	CREATE TABLE IF NOT EXISTS orphan_blobs (
+		ref VARCHAR(128) NOT NULL PRIMARY KEY,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_created_at (created_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+
+	if _, err := db.Exec(orphanBlobTableSQL); err != nil {
+		return fmt.Errorf("failed to create orphan_blobs table: %w", err)
+	}
+
+	// 创建领导者租约表（用于单例后台任务的选主）
+	leaseTableSQL := `
+	CREATE TABLE IF NOT EXISTS leader_leases (
+		name VARCHAR(64) NOT NULL PRIMARY KEY,
+		holder VARCHAR(128) NOT NULL,
+		expires_at DATETIME(3) NOT NULL,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+
+	if _, err := db.Exec(leaseTableSQL); err != nil {
+		return fmt.Errorf("failed to create leader_leases table: %w", err)
+	}
+
+	// 创建合作方签名密钥表（支持轮换期间多个有效密钥）
+	signingSecretTableSQL := `
+	CREATE TABLE IF NOT EXISTS partner_signing_secrets (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		secret_id VARCHAR(64) NOT NULL UNIQUE,
+		partner_id VARCHAR(32) NOT NULL,
+		secret VARCHAR(512) NOT NULL,
+		status VARCHAR(16) NOT NULL DEFAULT 'active',
+		expires_at DATETIME NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		key_id VARCHAR(64) NULL,
+		wrapped_key VARCHAR(255) NULL,
+		INDEX idx_partner_status (partner_id, status)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+
+	if _, err := db.Exec(signingSecretTableSQL); err != nil {
+		return fmt.Errorf("failed to create partner_signing_secrets table: %w", err)
+	}
+	// 启用静态加密时secret列保存密文，key_id为NULL表示明文（启用加密前写入）
+	if err := ensureColumns(db, "partner_signing_secrets", []columnDef{
+		{name: "key_id", definition: "VARCHAR(64) NULL"},
+		{name: "wrapped_key", definition: "VARCHAR(255) NULL"},
+	}); err != nil {
+		return err
+	}
+	if err := ensureColumnLength(db, "partner_signing_secrets", "secret", 512, "VARCHAR(512) NOT NULL"); err != nil {
+		return err
+	}
+
+	// 创建合作方模板表（请求体、请求头、URL路径模板）
+	templateTableSQL := `
+	CREATE TABLE IF NOT EXISTS partner_templates (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		partner_id VARCHAR(32) NOT NULL,
+		name VARCHAR(64) NOT NULL,
+		body_template MEDIUMTEXT,
+		headers_template TEXT,
+		url_template VARCHAR(1024),
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		UNIQUE KEY uk_partner_name (partner_id, name)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+
+	if _, err := db.Exec(templateTableSQL); err != nil {
+		return fmt.Errorf("failed to create partner_templates table: %w", err)
+	}
+
+	// 创建合作方密钥表（密钥值加密保存）
+	partnerSecretTableSQL := `
+	CREATE TABLE IF NOT EXISTS partner_secrets (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		partner_id VARCHAR(32) NOT NULL,
+		name VARCHAR(64) NOT NULL,
+		ciphertext TEXT NOT NULL,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		UNIQUE KEY uk_partner_name (partner_id, name)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+	`
+
+	if _, err := db.Exec(partnerSecretTableSQL); err != nil {
+		return fmt.Errorf("failed to create partner_secrets table: %w", err)
+	}
+
 	logger.Info("Database tables initialized successfully")
 	return nil
-}
\ No newline at end of file
+}
+
+// columnDef 增量列定义
+type columnDef struct {
+	name       string
+	definition string
+}
+
+// ensureColumns 为已存在的表补充缺失的列（CREATE TABLE IF NOT EXISTS不会修改已有表结构）
+func ensureColumns(db *sql.DB, table string, columns []columnDef) error {
+	for _, column := range columns {
+		var count int
+		query := `
+		SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+		`
+		if err := db.QueryRow(query, table, column.name).Scan(&count); err != nil {
+			return fmt.Errorf("failed to check column %s.%s: %w", table, column.name, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		alterSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column.name, column.definition)
+		if _, err := db.Exec(alterSQL); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", table, column.name, err)
+		}
+	}
+	return nil
+}
+
+// ensureColumnLength 将已存在表中长度小于length的字符串列扩展为definition
+func ensureColumnLength(db *sql.DB, table, column string, length int, definition string) error {
+	var current int
+	query := `
+	SELECT COALESCE(CHARACTER_MAXIMUM_LENGTH, 0) FROM information_schema.COLUMNS
+	WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+	`
+	if err := db.QueryRow(query, table, column).Scan(&current); err != nil {
+		return fmt.Errorf("failed to check column %s.%s: %w", table, column, err)
+	}
+	if current >= length {
+		return nil
+	}
+
+	alterSQL := fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s", table, column, definition)
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("failed to modify column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
+
+// ensureIndex 为已存在的表补充缺失的索引
+func ensureIndex(db *sql.DB, table, name, columns string) error {
+	var count int
+	query := `
+	SELECT COUNT(*) FROM information_schema.STATISTICS
+	WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND INDEX_NAME = ?
+	`
+	if err := db.QueryRow(query, table, name).Scan(&count); err != nil {
+		return fmt.Errorf("failed to check index %s.%s: %w", table, name, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	alterSQL := fmt.Sprintf("ALTER TABLE %s ADD INDEX %s (%s)", table, name, columns)
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("failed to add index %s.%s: %w", table, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"api-notify/internal/core"
+)
+
+// SavePartnerSecret 创建或替换合作方密钥（密文）
+func (s *Store) SavePartnerSecret(ctx context.Context, secret *core.PartnerSecret) error {
+	query := `
+	INSERT INTO partner_secrets (partner_id, name, ciphertext)
+	VALUES (?, ?, ?)
+	ON DUPLICATE KEY UPDATE ciphertext = VALUES(ciphertext)
+	`
+
+	if _, err := s.db.ExecContext(ctx, query, secret.PartnerID, secret.Name, secret.Ciphertext); err != nil {
+		return fmt.Errorf("failed to save partner secret: %w", err)
+	}
+
+	return nil
+}
+
+// GetPartnerSecret 查询合作方密钥，不存在时返回nil
+func (s *Store) GetPartnerSecret(ctx context.Context, partnerID, name string) (*core.PartnerSecret, error) {
+	query := `
+	SELECT id, partner_id, name, ciphertext, created_at, updated_at
+	FROM partner_secrets
+	WHERE partner_id = ? AND name = ?
+	`
+
+	var secret core.PartnerSecret
+	err := s.db.QueryRowContext(ctx, query, partnerID, name).Scan(
+		&secret.ID,
+		&secret.PartnerID,
+		&secret.Name,
+		&secret.Ciphertext,
+		&secret.CreatedAt,
+		&secret.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get partner secret: %w", err)
+	}
+
+	return &secret, nil
+}
+
+// ListPartnerSecrets 列出合作方的密钥（含密文，由调用方决定是否解密）
+func (s *Store) ListPartnerSecrets(ctx context.Context, partnerID string) ([]*core.PartnerSecret, error) {
+	query := `
+	SELECT id, partner_id, name, ciphertext, created_at, updated_at
+	FROM partner_secrets
+	WHERE partner_id = ?
+	ORDER BY name ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, partnerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partner secrets: %w", err)
+	}
+	defer rows.Close()
+
+	secrets := make([]*core.PartnerSecret, 0)
+	for rows.Next() {
+		var secret core.PartnerSecret
+		if err := rows.Scan(
+			&secret.ID,
+			&secret.PartnerID,
+			&secret.Name,
+			&secret.Ciphertext,
+			&secret.CreatedAt,
+			&secret.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan partner secret: %w", err)
+		}
+		secrets = append(secrets, &secret)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return secrets, nil
+}
+
+// DeletePartnerSecret 删除合作方密钥，返回是否找到该密钥
+func (s *Store) DeletePartnerSecret(ctx context.Context, partnerID, name string) (bool, error) {
+	query := "DELETE FROM partner_secrets WHERE partner_id = ? AND name = ?"
+
+	result, err := s.db.ExecContext(ctx, query, partnerID, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete partner secret: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// DeletePartnerSecretsByPrefix 删除合作方名称以prefix开头的全部密钥，返回删除的数量
+func (s *Store) DeletePartnerSecretsByPrefix(ctx context.Context, partnerID, prefix string) (int64, error) {
+	query := "DELETE FROM partner_secrets WHERE partner_id = ? AND name LIKE ?"
+
+	result, err := s.db.ExecContext(ctx, query, partnerID, escapeLike(prefix)+"%")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete partner secrets: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return affected, nil
+}
+
+// escapeLike 转义LIKE模式中的通配符
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
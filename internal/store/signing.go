@@ -0,0 +1,278 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"api-notify/internal/core"
+	"api-notify/internal/envelope"
+)
+
+// sealedSigningSecret 写入数据库的签名密钥，未启用加密时为明文且key_id为NULL
+type sealedSigningSecret struct {
+	secret     string
+	keyID      sql.NullString
+	wrappedKey sql.NullString
+}
+
+// signingSecretAAD 加密签名密钥时绑定的附加数据，密文不能被复制到其他密钥行或任务
+func signingSecretAAD(secretID, column string) []byte {
+	return []byte("partner_signing_secrets\x00" + secretID + "\x00" + column)
+}
+
+// sealSigningSecret 为签名密钥生成数据密钥并加密密钥值，与任务请求内容使用相同的静态加密密钥
+func (s *Store) sealSigningSecret(secretID, plaintext string) (*sealedSigningSecret, error) {
+	if s.keyring == nil {
+		return &sealedSigningSecret{secret: plaintext}, nil
+	}
+
+	dataKey, err := s.keyring.NewDataKey(signingSecretAAD(secretID, "data_key"))
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := dataKey.Seal([]byte(plaintext), signingSecretAAD(secretID, "secret"))
+	if err != nil {
+		return nil, err
+	}
+	return &sealedSigningSecret{
+		secret:     ciphertext,
+		keyID:      sql.NullString{String: dataKey.KeyID, Valid: true},
+		wrappedKey: sql.NullString{String: dataKey.Wrapped, Valid: true},
+	}, nil
+}
+
+// openSigningSecret 解密签名密钥，keyID为空表示该行为明文（启用加密前写入）
+func (s *Store) openSigningSecret(secret *core.SigningSecret, keyID, wrappedKey string) error {
+	if keyID == "" {
+		return nil
+	}
+	if s.keyring == nil {
+		return fmt.Errorf("signing secret %s: %w: payload encryption keys are not configured", secret.SecretID, envelope.ErrUnknownKey)
+	}
+
+	dataKey, err := s.keyring.OpenDataKey(keyID, wrappedKey, signingSecretAAD(secret.SecretID, "data_key"))
+	if err != nil {
+		return fmt.Errorf("signing secret %s: %w", secret.SecretID, err)
+	}
+	plaintext, err := dataKey.Open(secret.Secret, signingSecretAAD(secret.SecretID, "secret"))
+	if err != nil {
+		return fmt.Errorf("signing secret %s: %w", secret.SecretID, err)
+	}
+	secret.Secret = string(plaintext)
+	return nil
+}
+
+// CreateSigningSecret 创建签名密钥
+// rotateAt非nil时，该合作方现有的有效密钥将在rotateAt之后失效（轮换宽限期）
+func (s *Store) CreateSigningSecret(ctx context.Context, secret *core.SigningSecret, rotateAt *time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if rotateAt != nil {
+		query := `
+		UPDATE partner_signing_secrets
+		SET expires_at = ?
+		WHERE partner_id = ? AND status = ? AND (expires_at IS NULL OR expires_at > ?)
+		`
+		if _, err := tx.ExecContext(ctx, query, *rotateAt, secret.PartnerID, core.SigningSecretStatusActive, *rotateAt); err != nil {
+			return fmt.Errorf("failed to expire previous signing secrets: %w", err)
+		}
+	}
+
+	sealed, err := s.sealSigningSecret(secret.SecretID, secret.Secret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt signing secret: %w", err)
+	}
+
+	query := `
+	INSERT INTO partner_signing_secrets (secret_id, partner_id, secret, status, created_at, key_id, wrapped_key)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	if _, err := tx.ExecContext(ctx, query, secret.SecretID, secret.PartnerID, sealed.secret, secret.Status, secret.CreatedAt, sealed.keyID, sealed.wrappedKey); err != nil {
+		return fmt.Errorf("failed to create signing secret: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit signing secret: %w", err)
+	}
+
+	return nil
+}
+
+// ListSigningSecrets 列出合作方的所有签名密钥，不读取密钥值
+func (s *Store) ListSigningSecrets(ctx context.Context, partnerID string) ([]*core.SigningSecret, error) {
+	query := `
+	SELECT id, secret_id, partner_id, '', status, expires_at, created_at, '', ''
+	FROM partner_signing_secrets
+	WHERE partner_id = ?
+	ORDER BY created_at DESC
+	`
+
+	return s.querySigningSecrets(ctx, query, partnerID)
+}
+
+// GetActiveSigningSecrets 获取合作方当前参与签名的密钥（含轮换宽限期内的旧密钥），密钥值已解密
+func (s *Store) GetActiveSigningSecrets(ctx context.Context, partnerID string) ([]*core.SigningSecret, error) {
+	query := `
+	SELECT id, secret_id, partner_id, secret, status, expires_at, created_at, COALESCE(key_id, ''), COALESCE(wrapped_key, '')
+	FROM partner_signing_secrets
+	WHERE partner_id = ? AND status = ? AND (expires_at IS NULL OR expires_at > NOW())
+	ORDER BY created_at DESC
+	`
+
+	return s.querySigningSecrets(ctx, query, partnerID, core.SigningSecretStatusActive)
+}
+
+// RevokeSigningSecret 立即吊销签名密钥，返回是否找到该密钥
+func (s *Store) RevokeSigningSecret(ctx context.Context, partnerID, secretID string) (bool, error) {
+	query := `
+	UPDATE partner_signing_secrets
+	SET status = ?
+	WHERE partner_id = ? AND secret_id = ?
+	`
+
+	result, err := s.db.ExecContext(ctx, query, core.SigningSecretStatusRevoked, partnerID, secretID)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke signing secret: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke signing secret: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// querySigningSecrets 执行查询并扫描签名密钥，加密的密钥值解密后返回
+func (s *Store) querySigningSecrets(ctx context.Context, query string, args ...interface{}) ([]*core.SigningSecret, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signing secrets: %w", err)
+	}
+	defer rows.Close()
+
+	secrets := make([]*core.SigningSecret, 0)
+	for rows.Next() {
+		var secret core.SigningSecret
+		var expiresAt sql.NullTime
+		var keyID, wrappedKey string
+		if err := rows.Scan(
+			&secret.ID,
+			&secret.SecretID,
+			&secret.PartnerID,
+			&secret.Secret,
+			&secret.Status,
+			&expiresAt,
+			&secret.CreatedAt,
+			&keyID,
+			&wrappedKey,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan signing secret: %w", err)
+		}
+		if err := s.openSigningSecret(&secret, keyID, wrappedKey); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			secret.ExpiresAt = &expiresAt.Time
+		}
+		secrets = append(secrets, &secret)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return secrets, nil
+}
+
+// ReencryptSigningSecrets 将未使用当前密钥的签名密钥改用当前密钥：明文行加密，旧密钥包装的行只重新包装数据密钥
+// 返回处理的行数；无法解密的行记录日志后跳过
+func (s *Store) ReencryptSigningSecrets(ctx context.Context) (int, error) {
+	if s.keyring == nil {
+		return 0, nil
+	}
+
+	query := `
+	SELECT id, secret_id, secret, COALESCE(key_id, ''), COALESCE(wrapped_key, '')
+	FROM partner_signing_secrets
+	WHERE key_id IS NULL OR key_id <> ?
+	`
+	rows, err := s.db.QueryContext(ctx, query, s.keyring.ActiveKeyID())
+	if err != nil {
+		return 0, fmt.Errorf("failed to query signing secrets for re-encryption: %w", err)
+	}
+
+	type pendingRow struct {
+		id         uint64
+		secretID   string
+		secret     string
+		keyID      string
+		wrappedKey string
+	}
+	var batch []pendingRow
+	for rows.Next() {
+		var row pendingRow
+		if err := rows.Scan(&row.id, &row.secretID, &row.secret, &row.keyID, &row.wrappedKey); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan signing secret for re-encryption: %w", err)
+		}
+		batch = append(batch, row)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return 0, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	processed := 0
+	for _, row := range batch {
+		var result sql.Result
+		if row.keyID == "" {
+			sealed, err := s.sealSigningSecret(row.secretID, row.secret)
+			if err != nil {
+				return processed, fmt.Errorf("failed to encrypt signing secret %s: %w", row.secretID, err)
+			}
+			result, err = s.db.ExecContext(ctx, `
+			UPDATE partner_signing_secrets
+			SET secret = ?, key_id = ?, wrapped_key = ?
+			WHERE id = ? AND key_id IS NULL
+			`, sealed.secret, sealed.keyID, sealed.wrappedKey, row.id)
+			if err != nil {
+				return processed, fmt.Errorf("failed to encrypt signing secret %s: %w", row.secretID, err)
+			}
+		} else {
+			dataKey, err := s.keyring.Rewrap(row.keyID, row.wrappedKey, signingSecretAAD(row.secretID, "data_key"))
+			if errors.Is(err, envelope.ErrDecrypt) {
+				s.logger.Error("Skipping re-encryption of signing secret %s: %v", row.secretID, err)
+				continue
+			}
+			if err != nil {
+				return processed, err
+			}
+			result, err = s.db.ExecContext(ctx, `
+			UPDATE partner_signing_secrets
+			SET key_id = ?, wrapped_key = ?
+			WHERE id = ? AND key_id = ? AND wrapped_key = ?
+			`, dataKey.KeyID, dataKey.Wrapped, row.id, row.keyID, row.wrappedKey)
+			if err != nil {
+				return processed, fmt.Errorf("failed to rewrap data key of signing secret %s: %w", row.secretID, err)
+			}
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return processed, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		if affected > 0 {
+			processed++
+		}
+	}
+	return processed, nil
+}
@@ -3,39 +3,123 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"api-notify/internal/core"
+	"api-notify/internal/envelope"
 )
 
+// taskColumns 查询任务时的列，顺序需与scanTask一致
+const taskColumns = `
+		id, task_id, partner_id, target_url, http_method, headers, body, 
+		idempotency_key, priority, status, next_attempt_at, max_attempts, success_condition,
+		COALESCE(timeouts, ''), COALESCE(event_type, ''), COALESCE(callback_url, ''),
+		COALESCE(template_name, ''), COALESCE(template_data, ''),
+		COALESCE(body_encoding, ''), created_at, updated_at,
+		COALESCE(key_id, ''), COALESCE(wrapped_key, ''), COALESCE(body_ref, ''), expires_at`
+
+// rowScanner 兼容*sql.Row和*sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTask 扫描一行任务数据，请求头、请求体和模板数据已加密时解密
+// 解密失败时同时返回任务（加密列仍为密文）和错误，便于调用方处理该任务
+func (s *Store) scanTask(row rowScanner) (*core.NotificationTask, error) {
+	var task core.NotificationTask
+	var keyID, wrappedKey string
+	var expiresAt sql.NullTime
+	err := row.Scan(
+		&task.ID,
+		&task.TaskID,
+		&task.PartnerID,
+		&task.TargetURL,
+		&task.HTTPMethod,
+		&task.Headers,
+		&task.Body,
+		&task.IdempotencyKey,
+		&task.Priority,
+		&task.Status,
+		&task.NextAttemptAt,
+		&task.MaxAttempts,
+		&task.SuccessCondition,
+		&task.Timeouts,
+		&task.EventType,
+		&task.CallbackURL,
+		&task.TemplateName,
+		&task.TemplateData,
+		&task.BodyEncoding,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+		&keyID,
+		&wrappedKey,
+		&task.BodyRef,
+		&expiresAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt.Valid {
+		task.ExpiresAt = &expiresAt.Time
+	}
+	if err := s.decryptPayload(&task, keyID, wrappedKey); err != nil {
+		return &task, err
+	}
+	return &task, nil
+}
+
 // CreateTask 创建通知任务
 func (s *Store) CreateTask(ctx context.Context, task *core.NotificationTask) error {
 	query := `
 	INSERT INTO notification_tasks (
 		task_id, partner_id, target_url, http_method, headers, body, 
-		idempotency_key, priority, status, next_attempt_at, max_attempts, success_condition
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		idempotency_key, priority, status, next_attempt_at, max_attempts, success_condition, timeouts,
+		event_type, callback_url, template_name, template_data, body_encoding, key_id, wrapped_key, body_ref, expires_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := s.db.ExecContext(
+	sealed, err := s.encryptPayload(task)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt task payload: %w", err)
+	}
+	if err := s.offloadBody(ctx, sealed, len(task.Body)); err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(
 		ctx,
 		query,
 		task.TaskID,
 		task.PartnerID,
 		task.TargetURL,
 		task.HTTPMethod,
-		task.Headers,
-		task.Body,
+		sealed.headers,
+		sealed.body,
 		task.IdempotencyKey,
 		task.Priority,
 		task.Status,
 		task.NextAttemptAt,
 		task.MaxAttempts,
 		task.SuccessCondition,
+		task.Timeouts,
+		task.EventType,
+		task.CallbackURL,
+		task.TemplateName,
+		sealed.templateData,
+		task.BodyEncoding,
+		sealed.keyID,
+		sealed.wrappedKey,
+		sealed.bodyRef,
+		task.ExpiresAt,
 	)
 
 	if err != nil {
+		// 已写入blob存储的请求体没有任务引用，交给回收任务删除
+		if sealed.bodyRef.Valid {
+			s.markOrphanBlob(ctx, sealed.bodyRef.String)
+		}
 		return fmt.Errorf("failed to create task: %w", err)
 	}
 
@@ -45,31 +129,11 @@ func (s *Store) CreateTask(ctx context.Context, task *core.NotificationTask) err
 // GetTaskByID 根据ID查询任务
 func (s *Store) GetTaskByID(ctx context.Context, id uint64) (*core.NotificationTask, error) {
 	query := `
-	SELECT 
-		id, task_id, partner_id, target_url, http_method, headers, body, 
-		idempotency_key, priority, status, next_attempt_at, max_attempts, success_condition,
-		created_at, updated_at
+	SELECT ` + taskColumns + `
 	FROM notification_tasks WHERE id = ?
 	`
 
-	var task core.NotificationTask
-	err := s.db.QueryRowContext(ctx, query, id).Scan(
-		&task.ID,
-		&task.TaskID,
-		&task.PartnerID,
-		&task.TargetURL,
-		&task.HTTPMethod,
-		&task.Headers,
-		&task.Body,
-		&task.IdempotencyKey,
-		&task.Priority,
-		&task.Status,
-		&task.NextAttemptAt,
-		&task.MaxAttempts,
-		&task.SuccessCondition,
-		&task.CreatedAt,
-		&task.UpdatedAt,
-	)
+	task, err := s.scanTask(s.db.QueryRowContext(ctx, query, id))
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -78,37 +142,17 @@ func (s *Store) GetTaskByID(ctx context.Context, id uint64) (*core.NotificationT
 		return nil, fmt.Errorf("failed to get task by id: %w", err)
 	}
 
-	return &task, nil
+	return task, nil
 }
 
 // GetTaskByTaskID 根据TaskID查询任务
 func (s *Store) GetTaskByTaskID(ctx context.Context, taskID string) (*core.NotificationTask, error) {
 	query := `
-	SELECT 
-		id, task_id, partner_id, target_url, http_method, headers, body, 
-		idempotency_key, priority, status, next_attempt_at, max_attempts, success_condition,
-		created_at, updated_at
+	SELECT ` + taskColumns + `
 	FROM notification_tasks WHERE task_id = ?
 	`
 
-	var task core.NotificationTask
-	err := s.db.QueryRowContext(ctx, query, taskID).Scan(
-		&task.ID,
-		&task.TaskID,
-		&task.PartnerID,
-		&task.TargetURL,
-		&task.HTTPMethod,
-		&task.Headers,
-		&task.Body,
-		&task.IdempotencyKey,
-		&task.Priority,
-		&task.Status,
-		&task.NextAttemptAt,
-		&task.MaxAttempts,
-		&task.SuccessCondition,
-		&task.CreatedAt,
-		&task.UpdatedAt,
-	)
+	task, err := s.scanTask(s.db.QueryRowContext(ctx, query, taskID))
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -117,37 +161,17 @@ func (s *Store) GetTaskByTaskID(ctx context.Context, taskID string) (*core.Notif
 		return nil, fmt.Errorf("failed to get task by task_id: %w", err)
 	}
 
-	return &task, nil
+	return task, nil
 }
 
 // GetTaskByIdempotencyKey 根据幂等键和partner_id查询任务
 func (s *Store) GetTaskByIdempotencyKey(ctx context.Context, idempotencyKey, partnerID string) (*core.NotificationTask, error) {
 	query := `
-	SELECT 
-		id, task_id, partner_id, target_url, http_method, headers, body, 
-		idempotency_key, priority, status, next_attempt_at, max_attempts, success_condition,
-		created_at, updated_at
+	SELECT ` + taskColumns + `
 	FROM notification_tasks WHERE idempotency_key = ? AND partner_id = ?
 	`
 
-	var task core.NotificationTask
-	err := s.db.QueryRowContext(ctx, query, idempotencyKey, partnerID).Scan(
-		&task.ID,
-		&task.TaskID,
-		&task.PartnerID,
-		&task.TargetURL,
-		&task.HTTPMethod,
-		&task.Headers,
-		&task.Body,
-		&task.IdempotencyKey,
-		&task.Priority,
-		&task.Status,
-		&task.NextAttemptAt,
-		&task.MaxAttempts,
-		&task.SuccessCondition,
-		&task.CreatedAt,
-		&task.UpdatedAt,
-	)
+	task, err := s.scanTask(s.db.QueryRowContext(ctx, query, idempotencyKey, partnerID))
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -156,16 +180,16 @@ func (s *Store) GetTaskByIdempotencyKey(ctx context.Context, idempotencyKey, par
 		return nil, fmt.Errorf("failed to get task by idempotency key: %w", err)
 	}
 
-	return &task, nil
+	return task, nil
 }
 
 // GetPendingTasks 获取待处理的任务（带行级锁避免重复消费）
 func (s *Store) GetPendingTasks(ctx context.Context, limit int) ([]*core.NotificationTask, error) {
-	// 使用MySQL行级锁，将状态更新为running并锁定行
+	// 使用MySQL行级锁，将状态更新为running并锁定行；已过期的任务不再取出，由ExpireTasks处理
 	query := `
 	UPDATE notification_tasks 
 	SET status = ? 
-	WHERE status IN (?, ?, ?) AND next_attempt_at <= NOW()
+	WHERE status IN (?, ?, ?) AND next_attempt_at <= NOW() AND (expires_at IS NULL OR expires_at > NOW())
 	ORDER BY priority DESC, next_attempt_at ASC
 	LIMIT ?
 	`
@@ -186,10 +210,7 @@ func (s *Store) GetPendingTasks(ctx context.Context, limit int) ([]*core.Notific
 
 	// 再查询已锁定的任务
 	selectQuery := `
-	SELECT 
-		id, task_id, partner_id, target_url, http_method, headers, body, 
-		idempotency_key, priority, status, next_attempt_at, max_attempts, success_condition,
-		created_at, updated_at
+	SELECT ` + taskColumns + `
 	FROM notification_tasks 
 	WHERE status = ?
 	ORDER BY priority DESC, next_attempt_at ASC
@@ -208,37 +229,114 @@ func (s *Store) GetPendingTasks(ctx context.Context, limit int) ([]*core.Notific
 	defer rows.Close()
 
 	tasks := make([]*core.NotificationTask, 0, limit)
+	undecryptable := make(map[*core.NotificationTask]error)
 	for rows.Next() {
-		var task core.NotificationTask
-		if err := rows.Scan(
-			&task.ID,
-			&task.TaskID,
-			&task.PartnerID,
-			&task.TargetURL,
-			&task.HTTPMethod,
-			&task.Headers,
-			&task.Body,
-			&task.IdempotencyKey,
-			&task.Priority,
-			&task.Status,
-			&task.NextAttemptAt,
-			&task.MaxAttempts,
-			&task.SuccessCondition,
-			&task.CreatedAt,
-			&task.UpdatedAt,
-		); err != nil {
+		task, err := s.scanTask(rows)
+		if errors.Is(err, envelope.ErrDecrypt) {
+			undecryptable[task] = err
+			continue
+		}
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan task: %w", err)
 		}
-		tasks = append(tasks, &task)
+		tasks = append(tasks, task)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("rows iteration error: %w", err)
 	}
+	rows.Close()
+
+	// 无法解密的任务（如所用密钥已从配置中移除）推迟处理，不占用后续轮询的名额，恢复密钥后继续投递
+	for task, decryptErr := range undecryptable {
+		if err := s.deferUndecryptableTask(ctx, task, decryptErr); err != nil {
+			s.logger.Error("Failed to defer undecryptable task %s: %v", task.TaskID, err)
+		}
+	}
 
 	return tasks, nil
 }
 
+// undecryptableRetryDelay 无法解密的任务再次尝试的间隔
+const undecryptableRetryDelay = 10 * time.Minute
+
+// deferUndecryptableTask 记录解密失败的尝试（错误码PAYLOAD_DECRYPT_FAILED），将任务改回pending并推迟下次尝试时间
+func (s *Store) deferUndecryptableTask(ctx context.Context, task *core.NotificationTask, decryptErr error) error {
+	s.logger.Error("Task %s cannot be decrypted, retrying in %s: %v", task.TaskID, undecryptableRetryDelay, decryptErr)
+
+	attemptCount, err := s.GetAttemptCount(ctx, task.TaskID)
+	if err != nil {
+		return err
+	}
+	if err := s.RecordAttempt(ctx, &core.NotificationAttempt{
+		TaskID:       task.TaskID,
+		AttemptNo:    attemptCount + 1,
+		Status:       core.AttemptStatusFailed,
+		ErrorCode:    "PAYLOAD_DECRYPT_FAILED",
+		ErrorMessage: decryptErr.Error(),
+		CreatedAt:    time.Now(),
+	}); err != nil {
+		return err
+	}
+	return s.UpdateTaskStatus(ctx, task.TaskID, core.TaskStatusPending, time.Now().Add(undecryptableRetryDelay))
+}
+
+// ExpireTasks 将超过过期时间仍在等待投递的任务改为expired，返回本次改为expired的任务
+// 等待投递包括pending/failed，以及等待重试（running且下次尝试时间在未来）的任务；
+// 正在投递的任务不处理，投递结束后若仍未成功会在之后被处理
+func (s *Store) ExpireTasks(ctx context.Context, limit int) ([]*core.NotificationTask, error) {
+	query := `
+	SELECT ` + taskColumns + `
+	FROM notification_tasks
+	WHERE expires_at <= NOW() AND (status IN (?, ?) OR (status = ? AND next_attempt_at > NOW()))
+	ORDER BY expires_at ASC
+	LIMIT ?
+	`
+	rows, err := s.db.QueryContext(ctx, query, core.TaskStatusPending, core.TaskStatusFailed, core.TaskStatusRunning, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired tasks: %w", err)
+	}
+	var candidates []*core.NotificationTask
+	for rows.Next() {
+		// 过期处理不需要请求内容，无法解密的任务同样过期
+		task, err := s.scanTask(rows)
+		if err != nil && !errors.Is(err, envelope.ErrDecrypt) {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan task: %w", err)
+		}
+		candidates = append(candidates, task)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	// 逐个按状态条件更新，期间被取出投递或取消的任务不改为expired
+	// 等待重试的任务处于running状态且下次尝试时间在未来；正在投递的running任务不改为expired
+	updateQuery := `
+	UPDATE notification_tasks
+	SET status = ?
+	WHERE task_id = ? AND (status IN (?, ?) OR (status = ? AND next_attempt_at > NOW()))
+	`
+	expired := make([]*core.NotificationTask, 0, len(candidates))
+	for _, task := range candidates {
+		result, err := s.db.ExecContext(ctx, updateQuery, core.TaskStatusExpired, task.TaskID, core.TaskStatusPending, core.TaskStatusFailed, core.TaskStatusRunning)
+		if err != nil {
+			return expired, fmt.Errorf("failed to expire task %s: %w", task.TaskID, err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return expired, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		if affected > 0 {
+			task.Status = core.TaskStatusExpired
+			expired = append(expired, task)
+		}
+	}
+	return expired, nil
+}
+
 // UpdateTaskStatus 更新任务状态
 func (s *Store) UpdateTaskStatus(ctx context.Context, taskID string, status core.TaskStatus, nextAttemptAt time.Time) error {
 	query := `
@@ -259,8 +357,10 @@ func (s *Store) UpdateTaskStatus(ctx context.Context, taskID string, status core
 func (s *Store) RecordAttempt(ctx context.Context, attempt *core.NotificationAttempt) error {
 	query := `
 	INSERT INTO notification_attempts (
-		task_id, attempt_no, status, http_status_code, error_code, error_message, latency_ms, created_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		task_id, attempt_no, status, http_status_code, error_code, error_message, latency_ms, redirect_chain,
+		response_body, response_headers, dns_ms, connect_ms, tls_handshake_ms, ttfb_ms, transfer_ms,
+		conn_reused, remote_ip, request_snapshot, created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	_, err := s.db.ExecContext(
@@ -273,6 +373,17 @@ func (s *Store) RecordAttempt(ctx context.Context, attempt *core.NotificationAtt
 		attempt.ErrorCode,
 		attempt.ErrorMessage,
 		attempt.LatencyMs,
+		attempt.RedirectChain,
+		attempt.ResponseBody,
+		attempt.ResponseHeaders,
+		attempt.DNSMs,
+		attempt.ConnectMs,
+		attempt.TLSHandshakeMs,
+		attempt.TTFBMs,
+		attempt.TransferMs,
+		attempt.ConnReused,
+		attempt.RemoteIP,
+		attempt.RequestSnapshot,
 		attempt.CreatedAt,
 	)
 
@@ -300,7 +411,10 @@ func (s *Store) GetAttemptCount(ctx context.Context, taskID string) (int, error)
 func (s *Store) GetAttemptsByTaskID(ctx context.Context, taskID string) ([]*core.NotificationAttempt, error) {
 	query := `
 	SELECT 
-		id, task_id, attempt_no, status, http_status_code, error_code, error_message, latency_ms, created_at
+		id, task_id, attempt_no, status, http_status_code, error_code, error_message, latency_ms,
+		COALESCE(redirect_chain, ''), COALESCE(response_body, ''), COALESCE(response_headers, ''),
+		dns_ms, connect_ms, tls_handshake_ms, ttfb_ms, transfer_ms, conn_reused, COALESCE(remote_ip, ''),
+		COALESCE(request_snapshot, ''), created_at
 	FROM notification_attempts 
 	WHERE task_id = ? 
 	ORDER BY created_at ASC
@@ -324,6 +438,17 @@ func (s *Store) GetAttemptsByTaskID(ctx context.Context, taskID string) ([]*core
 			&attempt.ErrorCode,
 			&attempt.ErrorMessage,
 			&attempt.LatencyMs,
+			&attempt.RedirectChain,
+			&attempt.ResponseBody,
+			&attempt.ResponseHeaders,
+			&attempt.DNSMs,
+			&attempt.ConnectMs,
+			&attempt.TLSHandshakeMs,
+			&attempt.TTFBMs,
+			&attempt.TransferMs,
+			&attempt.ConnReused,
+			&attempt.RemoteIP,
+			&attempt.RequestSnapshot,
 			&attempt.CreatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan attempt: %w", err)
@@ -352,4 +477,20 @@ func (s *Store) UpdateTaskRetry(ctx context.Context, taskID string, attemptCount
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// UpdateTaskTargetURL 更新任务的目标URL（如接收方返回永久重定向）
+func (s *Store) UpdateTaskTargetURL(ctx context.Context, taskID, targetURL string) error {
+	query := `
+	UPDATE notification_tasks 
+	SET target_url = ? 
+	WHERE task_id = ?
+	`
+
+	_, err := s.db.ExecContext(ctx, query, targetURL, taskID)
+	if err != nil {
+		return fmt.Errorf("failed to update task target url: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"api-notify/internal/core"
+)
+
+// SaveTemplate 创建或替换合作方模板
+func (s *Store) SaveTemplate(ctx context.Context, tmpl *core.Template) error {
+	query := `
+	INSERT INTO partner_templates (partner_id, name, body_template, headers_template, url_template)
+	VALUES (?, ?, ?, ?, ?)
+	ON DUPLICATE KEY UPDATE
+		body_template = VALUES(body_template),
+		headers_template = VALUES(headers_template),
+		url_template = VALUES(url_template)
+	`
+
+	_, err := s.db.ExecContext(ctx, query, tmpl.PartnerID, tmpl.Name, tmpl.BodyTemplate, tmpl.HeadersTemplate, tmpl.URLTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to save template: %w", err)
+	}
+
+	return nil
+}
+
+// GetTemplate 查询合作方模板，不存在时返回nil
+func (s *Store) GetTemplate(ctx context.Context, partnerID, name string) (*core.Template, error) {
+	query := `
+	SELECT id, partner_id, name, COALESCE(body_template, ''), COALESCE(headers_template, ''),
+		COALESCE(url_template, ''), created_at, updated_at
+	FROM partner_templates
+	WHERE partner_id = ? AND name = ?
+	`
+
+	var tmpl core.Template
+	err := s.db.QueryRowContext(ctx, query, partnerID, name).Scan(
+		&tmpl.ID,
+		&tmpl.PartnerID,
+		&tmpl.Name,
+		&tmpl.BodyTemplate,
+		&tmpl.HeadersTemplate,
+		&tmpl.URLTemplate,
+		&tmpl.CreatedAt,
+		&tmpl.UpdatedAt,
+	)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+
+	return &tmpl, nil
+}
+
+// ListTemplates 列出合作方的所有模板
+func (s *Store) ListTemplates(ctx context.Context, partnerID string) ([]*core.Template, error) {
+	query := `
+	SELECT id, partner_id, name, COALESCE(body_template, ''), COALESCE(headers_template, ''),
+		COALESCE(url_template, ''), created_at, updated_at
+	FROM partner_templates
+	WHERE partner_id = ?
+	ORDER BY name ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, partnerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	defer rows.Close()
+
+	templates := make([]*core.Template, 0)
+	for rows.Next() {
+		var tmpl core.Template
+		if err := rows.Scan(
+			&tmpl.ID,
+			&tmpl.PartnerID,
+			&tmpl.Name,
+			&tmpl.BodyTemplate,
+			&tmpl.HeadersTemplate,
+			&tmpl.URLTemplate,
+			&tmpl.CreatedAt,
+			&tmpl.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan template: %w", err)
+		}
+		templates = append(templates, &tmpl)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return templates, nil
+}
+
+// DeleteTemplate 删除合作方模板，返回是否找到该模板
+func (s *Store) DeleteTemplate(ctx context.Context, partnerID, name string) (bool, error) {
+	query := "DELETE FROM partner_templates WHERE partner_id = ? AND name = ?"
+
+	result, err := s.db.ExecContext(ctx, query, partnerID, name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete template: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
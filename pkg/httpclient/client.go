@@ -3,9 +3,16 @@ package httpclient
 import (
 	"bytes"
 	"context"
-	"io/ioutil"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"api-notify/pkg/logging"
@@ -13,45 +20,227 @@ import (
 
 // Client HTTP客户端
 type Client struct {
-	client  *http.Client
-	logger  *logging.Logger
+	client *http.Client
+	logger *logging.Logger
+
+	allowRedirect func(profile string, target *url.URL) error
+	// maxResponseBytes 最多读取的响应体字节数
+	maxResponseBytes int64
+	// timeouts 请求未指定时使用的默认超时
+	timeouts Timeouts
+
+	// 按配置档（通常为合作方ID）区分的传输层，未命中时使用默认传输层
+	mu       sync.RWMutex
+	profiles map[string]*profileTransport
+	// unixTransports 按套接字路径区分的Unix域套接字传输层
+	unixTransports map[string]*http.Transport
+}
+
+// Config 客户端配置
+type Config struct {
+	// Profiles 按配置档名称索引的传输层配置
+	Profiles map[string]Profile
+	// IPPolicy 建立连接时对目标IP的检查策略，为nil时不检查
+	IPPolicy *IPPolicy
+	// AllowRedirect 检查重定向目标是否被允许，返回错误时拒绝该重定向
+	AllowRedirect func(profile string, target *url.URL) error
+	// MaxResponseBytes 最多读取的响应体字节数，超出部分被丢弃，0表示使用默认值
+	MaxResponseBytes int64
+	// Timeouts 默认超时时间，字段为0时使用内置默认值
+	Timeouts Timeouts
+	// Proxy 默认出站代理，为nil时直连
+	Proxy *ProxyConfig
+}
+
+// defaultMaxResponseBytes 默认最多读取的响应体字节数
+const defaultMaxResponseBytes = 1 << 20
+
+// Profile 单个配置档的传输层配置
+type Profile struct {
+	TLS *TLSProfile
+	// Proxy 配置档专用代理，为nil时使用默认代理，URL为空时直连
+	Proxy *ProxyConfig
+}
+
+// Request 待发送的HTTP请求
+type Request struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    []byte
+	// Profile 使用的配置档名称，为空或未配置时使用默认传输层
+	Profile string
+	// Redirect 重定向策略，零值表示跟随（最多10跳）
+	Redirect RedirectPolicy
+	// Timeouts 覆盖客户端默认超时，字段为0时使用默认值
+	Timeouts Timeouts
+	// Compression 请求体压缩设置，零值表示不压缩
+	Compression Compression
+	// LogURL 日志中显示的URL（如替换密钥前的占位符形式），为空时使用URL；两者都会再经过sanitizeURL脱敏
+	LogURL string
+	// OmitResponseBodyLog 不在日志中记录响应体（如包含访问令牌的令牌端点响应）
+	OmitResponseBodyLog bool
 }
 
 // Response HTTP响应
 type Response struct {
 	StatusCode int
+	Headers    http.Header
 	Body       []byte
-	Latency    time.Duration
+	// Truncated 响应体超过读取上限被截断
+	Truncated bool
+	Latency   time.Duration
+	// Redirects 实际跟随的重定向链
+	Redirects []Redirect
+	// Timing 各阶段耗时
+	Timing Timing
+	// Sent 实际发出的请求
+	Sent SentRequest
+}
+
+// SentRequest 最后一次实际发出的请求头和请求体
+// 启用压缩时为压缩后的请求体和Content-Encoding头，接收方返回415后重发时为未压缩的请求
+type SentRequest struct {
+	Headers http.Header
+	Body    []byte
+}
+
+// RequestError 请求发送或读取响应失败，携带失败前已经收集到的各阶段耗时和重定向链
+type RequestError struct {
+	Err error
+	// Timing 失败前完成的阶段耗时，未开始的阶段为0
+	Timing Timing
+	// Redirects 失败前经过的重定向链，重定向被拒绝或超过跳数时最后一跳为被拒绝的目标
+	Redirects []Redirect
+	// Sent 失败前发出（或尝试发出）的请求
+	Sent SentRequest
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
 }
 
 // New 创建一个新的HTTP客户端
 func New(logger *logging.Logger) *Client {
+	client, _ := NewWithConfig(logger, Config{})
+	return client
+}
+
+// NewWithConfig 创建带配置档的HTTP客户端，配置档中的证书文件加载失败时返回错误
+func NewWithConfig(logger *logging.Logger, cfg Config) (*Client, error) {
+	proxy, err := newProxyRouter(cfg.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		// 超时由每个请求的上下文控制，不使用http.Client.Timeout
+		client: &http.Client{
+			Transport: newTransport(nil, cfg.IPPolicy, proxy),
+		},
+		logger:           logger,
+		allowRedirect:    cfg.AllowRedirect,
+		maxResponseBytes: cfg.MaxResponseBytes,
+		timeouts:         defaultTimeouts.Merge(cfg.Timeouts),
+		profiles:         make(map[string]*profileTransport),
+		unixTransports:   make(map[string]*http.Transport),
+	}
+
+	if c.maxResponseBytes <= 0 {
+		c.maxResponseBytes = defaultMaxResponseBytes
+	}
+
+	for name, profile := range cfg.Profiles {
+		if profile.Proxy == nil {
+			profile.Proxy = cfg.Proxy
+		}
+		pt, err := newProfileTransport(profile, cfg.IPPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load profile %s: %w", name, err)
+		}
+		c.profiles[name] = pt
+	}
+
+	return c, nil
+}
+
+// newTransport 创建传输层，tlsConfig为nil时使用默认TLS配置
+// policy用于在拨号时检查每个实际连接的IP（连接代理时除外），proxy为nil时直连
+// 连接、TLS握手和响应头超时按请求通过上下文控制（见withTimeouts），传输层不设置固定超时
+func newTransport(tlsConfig *tls.Config, policy *IPPolicy, proxy *proxyRouter) *http.Transport {
+	dialer := &net.Dialer{
+		KeepAlive: 30 * time.Second,
+		Control:   policy.dialControl(),
+	}
+	proxyDialer := &net.Dialer{
+		KeepAlive: 30 * time.Second,
+	}
+
 	// 配置传输层
-	transport := &http.Transport{
+	return &http.Transport{
 		// 限制最大连接数
 		MaxIdleConns:        100,
 		MaxIdleConnsPerHost: 10,
-		// 连接超时和读取超时
-		DialContext: (&net.Dialer{
-			Timeout:   5 * time.Second,  // 连接超时
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
-		TLSHandshakeTimeout:   5 * time.Second,
-		ResponseHeaderTimeout: 10 * time.Second,
-	}
-
-	return &Client{
-		client: &http.Client{
-			Timeout:   10 * time.Second, // 总超时时间（3～10s）
-			Transport: transport,
-		}, 
-		logger: logger,
+		Proxy:               proxy.proxyFunc(),
+		DialContext:         dialContext(dialer, proxyDialer, proxy.proxyAddr()),
+		TLSClientConfig:     tlsConfig,
 	}
 }
 
 // Do 发送HTTP请求
 func (c *Client) Do(ctx context.Context, method, url string, headers map[string]string, body []byte) (*Response, error) {
+	return c.Send(ctx, &Request{
+		Method:  method,
+		URL:     url,
+		Headers: headers,
+		Body:    body,
+	})
+}
+
+// Send 使用请求指定的配置档发送HTTP请求
+// 请求启用压缩且接收方返回415时，以未压缩的请求体重发一次
+func (c *Client) Send(ctx context.Context, r *Request) (*Response, error) {
+	body, encoding, err := r.Compression.compress(r.Body, r.Headers)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.send(ctx, r, body, encoding)
+	if err == nil && encoding != "" && resp.StatusCode == http.StatusUnsupportedMediaType {
+		c.logger.Info("Receiver rejected %s encoded body with 415, retrying uncompressed: %s %s", encoding, r.Method, r.logURL())
+		return c.send(ctx, r, r.Body, "")
+	}
+	return resp, err
+}
+
+// send 发送单个HTTP请求，contentEncoding非空时body为已压缩的请求体
+func (c *Client) send(ctx context.Context, r *Request, body []byte, contentEncoding string) (*Response, error) {
 	startTime := time.Now()
+	method, url := r.Method, r.URL
+
+	// 按请求设置超时（请求级 > 客户端默认）
+	ctx, cancel := withTimeouts(ctx, c.timeouts.Merge(r.Timeouts))
+	defer cancel()
+
+	// 收集各阶段耗时
+	tracer := &timingTracer{}
+	ctx = httptrace.WithClientTrace(ctx, tracer.clientTrace())
+
+	// 记录传输层的代理选择结果，拨号时据此决定是否检查IP策略
+	ctx = withProxyDecision(ctx)
+
+	// http+unix目标改写为等价的http URL，通过套接字专用的传输层发送
+	socketPath := ""
+	if strings.HasPrefix(url, SchemeHTTPUnix+":") {
+		var err error
+		if socketPath, url, err = ParseUnixURL(url); err != nil {
+			return nil, err
+		}
+	}
 
 	// 创建请求
 	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
@@ -60,71 +249,133 @@ func (c *Client) Do(ctx context.Context, method, url string, headers map[string]
 	}
 
 	// 设置请求头
-	for k, v := range headers {
-		if isSensitiveHeader(k) {
-			req.Header.Set(k, "[REDACTED]")
-		} else {
-			req.Header.Set(k, v)
-		}
+	// 敏感头按真实值发送，仅在日志中脱敏
+	for k, v := range r.Headers {
+		req.Header.Set(k, v)
 	}
 
 	// 如果没有设置Content-Type，默认设置为application/json
 	if req.Header.Get("Content-Type") == "" && len(body) > 0 {
 		req.Header.Set("Content-Type", "application/json")
 	}
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
+
+	sent := SentRequest{Headers: req.Header.Clone(), Body: body}
 
 	// 发送请求
-	resp, err := c.client.Do(req)
+	var redirects []Redirect
+	client := c.httpClientFor(r.Profile)
+	client.CheckRedirect = redirectChecker(r.Profile, r.Redirect, c.allowRedirect, &redirects)
+	if socketPath != "" {
+		// 本地套接字不跟随重定向，避免被引导到其他目标
+		client = &http.Client{
+			Transport: c.unixTransportFor(socketPath),
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+	resp, err := client.Do(req)
 	if err != nil {
+		err = timeoutCause(ctx, err)
 		// 记录错误日志
-		c.logger.Error("HTTP Request failed: %s %s, Error: %v", method, sanitizeURL(url), err)
-		return nil, err
+		c.logger.Error("HTTP Request failed: %s %s, Error: %s", method, r.logURL(), describeError(err))
+		return nil, &RequestError{Err: err, Timing: tracer.finish(), Redirects: redirects, Sent: sent}
 	}
 	defer resp.Body.Close()
 
-	// 读取响应体
-	respBody, err := ioutil.ReadAll(resp.Body)
+	// 读取响应体（限制最大长度，避免接收方返回超大响应耗尽内存）
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, c.maxResponseBytes+1))
 	if err != nil {
-		c.logger.Error("Failed to read response body: %v", err)
-		return nil, err
+		err = timeoutCause(ctx, err)
+		c.logger.Error("Failed to read response body: %s %s, Error: %s", method, r.logURL(), describeError(err))
+		return nil, &RequestError{Err: err, Timing: tracer.finish(), Redirects: redirects, Sent: sent}
+	}
+	truncated := int64(len(respBody)) > c.maxResponseBytes
+	if truncated {
+		respBody = respBody[:c.maxResponseBytes]
 	}
 
 	latency := time.Since(startTime)
+	timing := tracer.finish()
 
 	// 截断响应体日志
 	respBodyLog := string(respBody)
 	if len(respBodyLog) > 100 {
 		respBodyLog = respBodyLog[:100] + "..."
 	}
+	if r.OmitResponseBodyLog {
+		respBodyLog = "[omitted]"
+	}
 
 	// 记录请求信息（脱敏）
-	c.logger.Debug("HTTP Request: %s %s, StatusCode: %d, Latency: %v, ResponseBody: %s", 
-		method, sanitizeURL(url), resp.StatusCode, latency, respBodyLog)
+	c.logger.Debug("HTTP Request: %s %s, StatusCode: %d, Latency: %v, ResponseBody: %s",
+		method, r.logURL(), resp.StatusCode, latency, respBodyLog)
 
 	return &Response{
 		StatusCode: resp.StatusCode,
+		Headers:    resp.Header,
 		Body:       respBody,
+		Truncated:  truncated,
 		Latency:    latency,
+		Redirects:  redirects,
+		Timing:     timing,
+		Sent:       sent,
 	}, nil
 }
 
-// isSensitiveHeader 检查是否为敏感头
-func isSensitiveHeader(key string) bool {
-	sensitiveHeaders := map[string]bool{
-		"Authorization": true,
-		"Cookie":        true,
-		"Set-Cookie":    true,
-		"X-Auth-Token":  true,
-		"Api-Key":       true,
-		"Token":         true,
+// httpClientFor 获取配置档对应的http.Client
+func (c *Client) httpClientFor(profile string) *http.Client {
+	transport := c.client.Transport
+	if profile != "" {
+		c.mu.RLock()
+		pt, ok := c.profiles[profile]
+		c.mu.RUnlock()
+		if ok {
+			transport = pt.current()
+		}
+	}
+
+	return &http.Client{
+		Transport: transport,
 	}
-	return sensitiveHeaders[key]
 }
 
-// sanitizeURL 脱敏URL
-func sanitizeURL(url string) string {
-	// 简单脱敏示例，实际可以根据需要扩展
-	return url
+// logURL 返回日志中显示的URL
+func (r *Request) logURL() string {
+	if r.LogURL != "" {
+		return sanitizeURL(r.LogURL)
+	}
+	return sanitizeURL(r.URL)
+}
+
+// sanitizeURL 脱敏URL：去掉用户信息和片段，查询参数只保留参数名
+func sanitizeURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "[invalid url]"
+	}
+	u.User = nil
+	u.Fragment = ""
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query[key] = []string{"REDACTED"}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+// describeError 返回用于日志的错误描述，*url.Error只保留操作和底层错误，不包含完整URL
+func describeError(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Sprintf("%s: %v", urlErr.Op, urlErr.Err)
+	}
+	return err.Error()
 }
 
 // Get 发送GET请求
@@ -135,4 +386,4 @@ func (c *Client) Get(ctx context.Context, url string, headers map[string]string)
 // Post 发送POST请求
 func (c *Client) Post(ctx context.Context, url string, headers map[string]string, body []byte) (*Response, error) {
 	return c.Do(ctx, http.MethodPost, url, headers, body)
-}
\ No newline at end of file
+}
@@ -0,0 +1,71 @@
+package httpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 请求体压缩算法
+const (
+	// CompressionGzip gzip（RFC 1952）
+	CompressionGzip = "gzip"
+	// CompressionDeflate HTTP中的deflate，即zlib格式（RFC 1950）
+	CompressionDeflate = "deflate"
+)
+
+// defaultCompressionMinSize 未指定阈值时，请求体达到该字节数才压缩
+const defaultCompressionMinSize = 1024
+
+// Compression 请求体压缩设置
+type Compression struct {
+	// Algorithm 压缩算法：gzip 或 deflate，为空表示不压缩
+	Algorithm string
+	// MinSize 请求体达到该字节数才压缩，0表示使用默认值（1KB）
+	MinSize int
+}
+
+// compress 按设置压缩请求体，返回请求体和使用的Content-Encoding（未压缩时为空）
+// 请求头中已指定Content-Encoding时视为调用方自行编码，不再压缩
+func (c Compression) compress(body []byte, headers map[string]string) ([]byte, string, error) {
+	if c.Algorithm == "" {
+		return body, "", nil
+	}
+
+	minSize := c.MinSize
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+	if len(body) < minSize {
+		return body, "", nil
+	}
+
+	for key := range headers {
+		if strings.EqualFold(key, "Content-Encoding") {
+			return body, "", nil
+		}
+	}
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch strings.ToLower(c.Algorithm) {
+	case CompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case CompressionDeflate:
+		w = zlib.NewWriter(&buf)
+	default:
+		return nil, "", fmt.Errorf("unsupported compression algorithm %q", c.Algorithm)
+	}
+
+	if _, err := w.Write(body); err != nil {
+		return nil, "", fmt.Errorf("failed to compress request body: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", fmt.Errorf("failed to compress request body: %w", err)
+	}
+
+	return buf.Bytes(), strings.ToLower(c.Algorithm), nil
+}
@@ -0,0 +1,107 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// ErrBlockedDestination 目标地址被出站策略拒绝（如解析到内网地址或重定向到非白名单主机）
+var ErrBlockedDestination = errors.New("destination blocked by egress policy")
+
+// IPPolicy 连接建立时的目标IP策略
+// 在net.Dialer.Control中对每个实际连接的IP生效，可防御DNS重绑定
+type IPPolicy struct {
+	// DenyPrivate 拒绝环回、内网、链路本地（含云厂商元数据地址）、组播等非公网地址
+	DenyPrivate bool
+	// AllowCIDRs 例外放行的网段，优先于拒绝规则
+	AllowCIDRs []*net.IPNet
+	// DenyCIDRs 额外拒绝的网段
+	DenyCIDRs []*net.IPNet
+}
+
+// nonPublicCIDRs net.IP方法未覆盖的非公网网段
+var nonPublicCIDRs = mustParseCIDRs(
+	"0.0.0.0/8",     // 本网络
+	"100.64.0.0/10", // 运营商级NAT
+	"192.0.0.0/24",  // IETF协议分配
+	"198.18.0.0/15", // 基准测试
+	"240.0.0.0/4",   // 保留
+	"64:ff9b::/96",  // NAT64
+)
+
+// ParseCIDRs 解析网段列表
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// mustParseCIDRs 解析内置网段列表
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets, err := ParseCIDRs(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return nets
+}
+
+// Check 检查IP是否允许连接
+func (p *IPPolicy) Check(ip net.IP) error {
+	if p == nil {
+		return nil
+	}
+
+	for _, ipNet := range p.AllowCIDRs {
+		if ipNet.Contains(ip) {
+			return nil
+		}
+	}
+
+	for _, ipNet := range p.DenyCIDRs {
+		if ipNet.Contains(ip) {
+			return fmt.Errorf("%w: %s is in denied range %s", ErrBlockedDestination, ip, ipNet)
+		}
+	}
+
+	if p.DenyPrivate {
+		if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+			ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+			ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+			return fmt.Errorf("%w: %s is not a public address", ErrBlockedDestination, ip)
+		}
+		for _, ipNet := range nonPublicCIDRs {
+			if ipNet.Contains(ip) {
+				return fmt.Errorf("%w: %s is not a public address", ErrBlockedDestination, ip)
+			}
+		}
+	}
+
+	return nil
+}
+
+// dialControl 返回net.Dialer.Control函数，在连接建立前检查已解析的目标IP
+func (p *IPPolicy) dialControl() func(network, address string, c syscall.RawConn) error {
+	if p == nil {
+		return nil
+	}
+
+	return func(network, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return fmt.Errorf("%w: invalid address %s", ErrBlockedDestination, address)
+		}
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return fmt.Errorf("%w: unresolved address %s", ErrBlockedDestination, address)
+		}
+		return p.Check(ip)
+	}
+}
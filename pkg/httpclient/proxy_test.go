@@ -0,0 +1,251 @@
+package httpclient
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"api-notify/pkg/logging"
+)
+
+// connectProxy 测试用的CONNECT代理，记录收到的隧道请求
+type connectProxy struct {
+	server *httptest.Server
+
+	mu         sync.Mutex
+	targets    []string
+	proxyAuths []string
+}
+
+// newConnectProxy 启动CONNECT代理
+func newConnectProxy(t *testing.T) *connectProxy {
+	t.Helper()
+	p := &connectProxy{}
+	p.server = httptest.NewServer(http.HandlerFunc(p.handle))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// handle 建立到目标的隧道并双向转发
+func (p *connectProxy) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodConnect {
+		http.Error(w, "only CONNECT is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	p.mu.Lock()
+	p.targets = append(p.targets, r.Host)
+	p.proxyAuths = append(p.proxyAuths, r.Header.Get("Proxy-Authorization"))
+	p.mu.Unlock()
+
+	upstream, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		upstream.Close()
+		return
+	}
+	conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+
+	go func() {
+		io.Copy(upstream, conn)
+		upstream.Close()
+	}()
+	io.Copy(conn, upstream)
+	conn.Close()
+}
+
+// url 代理地址，userinfo非空时带上用户名密码
+func (p *connectProxy) url(userinfo string) string {
+	if userinfo == "" {
+		return p.server.URL
+	}
+	return "http://" + userinfo + "@" + p.server.Listener.Addr().String()
+}
+
+// requests 返回收到的隧道目标和Proxy-Authorization头
+func (p *connectProxy) requests() ([]string, []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.targets...), append([]string(nil), p.proxyAuths...)
+}
+
+// newTLSTarget 启动HTTPS目标服务并返回信任其证书的TLS配置
+func newTLSTarget(t *testing.T) (*httptest.Server, *TLSProfile) {
+	t.Helper()
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	t.Cleanup(target.Close)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: target.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return target, &TLSProfile{CAFile: caFile}
+}
+
+// sendTo 通过指定配置档发送GET请求
+func sendTo(t *testing.T, client *Client, profile, url string) (*Response, error) {
+	t.Helper()
+	return client.Send(context.Background(), &Request{Method: http.MethodGet, URL: url, Profile: profile})
+}
+
+func TestProxyGlobalWithAuthorization(t *testing.T) {
+	proxy := newConnectProxy(t)
+	target, tlsProfile := newTLSTarget(t)
+
+	client, err := NewWithConfig(logging.New("error"), Config{
+		Proxy:    &ProxyConfig{URL: proxy.url("alice:s3cret")},
+		Profiles: map[string]Profile{"partner": {TLS: tlsProfile}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := sendTo(t, client, "partner", target.URL)
+	if err != nil {
+		t.Fatalf("send through proxy: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	targets, auths := proxy.requests()
+	if len(targets) != 1 || targets[0] != target.Listener.Addr().String() {
+		t.Fatalf("proxy targets = %v, want [%s]", targets, target.Listener.Addr())
+	}
+	wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("alice:s3cret"))
+	if auths[0] != wantAuth {
+		t.Fatalf("Proxy-Authorization = %q, want %q", auths[0], wantAuth)
+	}
+}
+
+func TestProxyPerProfile(t *testing.T) {
+	global := newConnectProxy(t)
+	partner := newConnectProxy(t)
+	target, tlsProfile := newTLSTarget(t)
+
+	client, err := NewWithConfig(logging.New("error"), Config{
+		Proxy: &ProxyConfig{URL: global.url("")},
+		Profiles: map[string]Profile{
+			"inherit": {TLS: tlsProfile},
+			"own":     {TLS: tlsProfile, Proxy: &ProxyConfig{URL: partner.url("")}},
+			"direct":  {TLS: tlsProfile, Proxy: &ProxyConfig{}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, profile := range []string{"inherit", "own", "direct"} {
+		if _, err := sendTo(t, client, profile, target.URL); err != nil {
+			t.Fatalf("send with profile %s: %v", profile, err)
+		}
+	}
+
+	if targets, _ := global.requests(); len(targets) != 1 {
+		t.Fatalf("global proxy got %d tunnels, want 1 (inherit only)", len(targets))
+	}
+	if targets, _ := partner.requests(); len(targets) != 1 {
+		t.Fatalf("partner proxy got %d tunnels, want 1 (own only)", len(targets))
+	}
+}
+
+func TestProxyNoProxyRules(t *testing.T) {
+	router, err := newProxyRouter(&ProxyConfig{
+		URL:     "http://proxy.internal:3128",
+		NoProxy: []string{"exact.test", ".suffix.test", "10.0.0.0/8", "192.0.2.7", "ported.test:8443"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url       string
+		wantProxy bool
+	}{
+		{"https://exact.test/hook", false},
+		{"https://api.exact.test/hook", false},
+		{"https://notexact.test/hook", true},
+		{"https://a.suffix.test/hook", false},
+		{"https://suffix.test/hook", true},
+		{"http://10.1.2.3:8080/hook", false},
+		{"http://11.1.2.3/hook", true},
+		{"http://192.0.2.7/hook", false},
+		{"http://192.0.2.8/hook", true},
+		{"https://ported.test:8443/hook", false},
+		{"https://ported.test/hook", true},
+		{"https://EXACT.TEST/hook", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+		got := router.choose(req) != nil
+		if got != tt.wantProxy {
+			t.Errorf("%s: via proxy = %v, want %v", tt.url, got, tt.wantProxy)
+		}
+	}
+}
+
+func TestProxyNoProxyBypassesProxy(t *testing.T) {
+	proxy := newConnectProxy(t)
+	target, tlsProfile := newTLSTarget(t)
+
+	client, err := NewWithConfig(logging.New("error"), Config{
+		Proxy:    &ProxyConfig{URL: proxy.url(""), NoProxy: []string{"127.0.0.0/8"}},
+		Profiles: map[string]Profile{"partner": {TLS: tlsProfile}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := sendTo(t, client, "partner", target.URL); err != nil {
+		t.Fatalf("direct send: %v", err)
+	}
+	if targets, _ := proxy.requests(); len(targets) != 0 {
+		t.Fatalf("proxy got tunnels %v for a no-proxy target", targets)
+	}
+}
+
+func TestProxyDirectDialEnforcesIPPolicy(t *testing.T) {
+	proxy := newConnectProxy(t)
+	target, tlsProfile := newTLSTarget(t)
+	proxyAddr := proxy.server.Listener.Addr().String()
+
+	client, err := NewWithConfig(logging.New("error"), Config{
+		IPPolicy: &IPPolicy{DenyPrivate: true},
+		Proxy:    &ProxyConfig{URL: proxy.url(""), NoProxy: []string{"localhost", proxyAddr}},
+		Profiles: map[string]Profile{"partner": {TLS: tlsProfile}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 经过代理时目标由代理解析，连接代理本身不受IP策略限制
+	if _, err := sendTo(t, client, "partner", target.URL); err != nil {
+		t.Fatalf("send through proxy: %v", err)
+	}
+
+	// 直连的目标仍然检查IP策略
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+	if _, err := sendTo(t, client, "partner", "https://localhost:"+port); !errors.Is(err, ErrBlockedDestination) {
+		t.Fatalf("direct send error = %v, want ErrBlockedDestination", err)
+	}
+
+	// 直连的目标与代理地址相同时同样检查
+	if _, err := sendTo(t, client, "", "http://"+proxyAddr); !errors.Is(err, ErrBlockedDestination) {
+		t.Fatalf("direct send to the proxy address error = %v, want ErrBlockedDestination", err)
+	}
+}
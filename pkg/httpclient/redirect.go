@@ -0,0 +1,60 @@
+package httpclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// defaultMaxRedirects 默认最多跟随的重定向次数（与net/http默认值一致）
+const defaultMaxRedirects = 10
+
+// RedirectPolicy 单个请求的重定向策略
+type RedirectPolicy struct {
+	// NoFollow 不跟随重定向，直接返回3xx响应
+	NoFollow bool
+	// MaxHops 最多跟随的重定向次数，0表示使用默认值
+	MaxHops int
+}
+
+// Redirect 重定向链中的一跳
+// From和To为原始URL，可能包含用户信息等凭据，写入日志或存储前需要脱敏
+type Redirect struct {
+	StatusCode int    `json:"status_code"`
+	From       string `json:"from"`
+	To         string `json:"to"`
+}
+
+// redirectChecker 返回http.Client.CheckRedirect函数
+// 按策略限制跳数，拒绝重定向到不被允许的主机，并记录经过的重定向链（包括被拒绝的一跳）
+func redirectChecker(profile string, policy RedirectPolicy, allow func(profile string, target *url.URL) error, chain *[]Redirect) func(req *http.Request, via []*http.Request) error {
+	maxHops := policy.MaxHops
+	if maxHops <= 0 {
+		maxHops = defaultMaxRedirects
+	}
+
+	return func(req *http.Request, via []*http.Request) error {
+		if policy.NoFollow {
+			return http.ErrUseLastResponse
+		}
+
+		hop := Redirect{To: req.URL.String()}
+		if req.Response != nil {
+			hop.StatusCode = req.Response.StatusCode
+		}
+		if len(via) > 0 {
+			hop.From = via[len(via)-1].URL.String()
+		}
+		*chain = append(*chain, hop)
+
+		if len(via) > maxHops {
+			return fmt.Errorf("stopped after %d redirects", maxHops)
+		}
+		if allow != nil {
+			if err := allow(profile, req.URL); err != nil {
+				return fmt.Errorf("%w: redirect to %s rejected: %v", ErrBlockedDestination, req.URL.Host, err)
+			}
+		}
+		return nil
+	}
+}
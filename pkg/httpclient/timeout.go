@@ -0,0 +1,142 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// ErrTimeout 请求超过配置的某个阶段超时时间
+var ErrTimeout = errors.New("request timeout")
+
+// Timeouts 请求各阶段的超时时间，字段为0时使用客户端默认值
+type Timeouts struct {
+	// Connect 建立TCP连接（不含DNS解析）
+	Connect time.Duration
+	// TLSHandshake TLS握手
+	TLSHandshake time.Duration
+	// ResponseHeader 请求写出后等待响应头
+	ResponseHeader time.Duration
+	// Total 从发起请求到读完响应体的总时间
+	Total time.Duration
+}
+
+// defaultTimeouts 内置的默认超时时间
+var defaultTimeouts = Timeouts{
+	Connect:        5 * time.Second,
+	TLSHandshake:   5 * time.Second,
+	ResponseHeader: 10 * time.Second,
+	Total:          10 * time.Second,
+}
+
+// Merge 用override中的非零字段覆盖t，返回新的超时配置
+func (t Timeouts) Merge(override Timeouts) Timeouts {
+	if override.Connect > 0 {
+		t.Connect = override.Connect
+	}
+	if override.TLSHandshake > 0 {
+		t.TLSHandshake = override.TLSHandshake
+	}
+	if override.ResponseHeader > 0 {
+		t.ResponseHeader = override.ResponseHeader
+	}
+	if override.Total > 0 {
+		t.Total = override.Total
+	}
+	return t
+}
+
+// phaseTimers 通过httptrace在各阶段开始时启动计时器，超时则以ErrTimeout为原因取消请求
+type phaseTimers struct {
+	cancel context.CancelCauseFunc
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+	done   bool
+}
+
+// withTimeouts 为请求上下文设置总超时和阶段超时，返回的cancel必须在请求结束后调用
+func withTimeouts(ctx context.Context, timeouts Timeouts) (context.Context, context.CancelFunc) {
+	ctx, cancelTotal := context.WithTimeoutCause(ctx, timeouts.Total,
+		fmt.Errorf("%w: total timeout %v exceeded", ErrTimeout, timeouts.Total))
+	ctx, cancelPhase := context.WithCancelCause(ctx)
+
+	p := &phaseTimers{cancel: cancelPhase, timers: make(map[string]*time.Timer)}
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(network, addr string) {
+			p.start("connect", timeouts.Connect)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			// 多地址并发拨号时，任一连接成功即视为连接阶段完成
+			if err == nil {
+				p.stop("connect")
+			}
+		},
+		TLSHandshakeStart: func() {
+			p.start("tls handshake", timeouts.TLSHandshake)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			p.stop("tls handshake")
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			p.start("response header", timeouts.ResponseHeader)
+		},
+		GotFirstResponseByte: func() {
+			p.stop("response header")
+		},
+	}
+
+	return httptrace.WithClientTrace(ctx, trace), func() {
+		p.stopAll()
+		cancelPhase(nil)
+		cancelTotal()
+	}
+}
+
+// start 启动阶段计时器，阶段计时中重复调用不会重新计时
+func (p *phaseTimers) start(phase string, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.done || p.timers[phase] != nil {
+		return
+	}
+	p.timers[phase] = time.AfterFunc(d, func() {
+		p.cancel(fmt.Errorf("%w: %s timeout %v exceeded", ErrTimeout, phase, d))
+	})
+}
+
+// stop 停止阶段计时器（跟随重定向建立新连接时可再次启动）
+func (p *phaseTimers) stop(phase string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if timer := p.timers[phase]; timer != nil {
+		timer.Stop()
+		delete(p.timers, phase)
+	}
+}
+
+// stopAll 请求结束后停止所有计时器，之后的追踪回调不再启动计时器
+func (p *phaseTimers) stopAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done = true
+	for _, timer := range p.timers {
+		timer.Stop()
+	}
+}
+
+// timeoutCause 请求因超时被取消时返回包含阶段信息的ErrTimeout，否则原样返回err
+func timeoutCause(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); cause != nil && errors.Is(cause, ErrTimeout) {
+		return cause
+	}
+	return err
+}
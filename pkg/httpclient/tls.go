@@ -0,0 +1,205 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSProfile 合作方TLS配置（双向TLS客户端证书、私有CA等）
+type TLSProfile struct {
+	// CertFile/KeyFile 客户端证书和私钥（PEM），用于双向TLS
+	CertFile string
+	KeyFile  string
+	// CAFile 信任的CA证书包（PEM），为空时使用系统根证书
+	CAFile string
+	// MinVersion 最低TLS版本："1.0"、"1.1"、"1.2"、"1.3"，默认1.2
+	MinVersion string
+	// ServerName 覆盖SNI及证书校验使用的主机名
+	ServerName string
+}
+
+// profileTransport 配置档的传输层，证书文件变化时重建
+type profileTransport struct {
+	profile  Profile
+	ipPolicy *IPPolicy
+	proxy    *proxyRouter
+
+	mu        sync.RWMutex
+	transport *http.Transport
+	modTimes  map[string]time.Time
+}
+
+// newProfileTransport 根据配置档创建传输层
+func newProfileTransport(profile Profile, ipPolicy *IPPolicy) (*profileTransport, error) {
+	proxy, err := newProxyRouter(profile.Proxy)
+	if err != nil {
+		return nil, err
+	}
+
+	pt := &profileTransport{profile: profile, ipPolicy: ipPolicy, proxy: proxy}
+	if err := pt.reload(); err != nil {
+		return nil, err
+	}
+	return pt, nil
+}
+
+// current 获取当前传输层
+func (pt *profileTransport) current() *http.Transport {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	return pt.transport
+}
+
+// reload 重新加载证书并替换传输层，旧传输层的空闲连接会被关闭
+func (pt *profileTransport) reload() error {
+	var tlsConfig *tls.Config
+	if pt.profile.TLS != nil {
+		var err error
+		tlsConfig, err = buildTLSConfig(pt.profile.TLS)
+		if err != nil {
+			return err
+		}
+	}
+
+	transport := newTransport(tlsConfig, pt.ipPolicy, pt.proxy)
+	modTimes := pt.fileModTimes()
+
+	pt.mu.Lock()
+	old := pt.transport
+	pt.transport = transport
+	pt.modTimes = modTimes
+	pt.mu.Unlock()
+
+	if old != nil {
+		old.CloseIdleConnections()
+	}
+	return nil
+}
+
+// changed 证书文件是否自上次加载后发生变化
+func (pt *profileTransport) changed() bool {
+	current := pt.fileModTimes()
+
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	for path, modTime := range current {
+		if !modTime.Equal(pt.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// fileModTimes 获取配置档引用的证书文件修改时间
+func (pt *profileTransport) fileModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	if pt.profile.TLS == nil {
+		return modTimes
+	}
+
+	for _, path := range []string{pt.profile.TLS.CertFile, pt.profile.TLS.KeyFile, pt.profile.TLS.CAFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// buildTLSConfig 根据TLS配置档构建tls.Config
+func buildTLSConfig(profile *TLSProfile) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(profile.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: minVersion,
+		ServerName: profile.ServerName,
+	}
+
+	// 加载客户端证书
+	if profile.CertFile != "" || profile.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(profile.CertFile, profile.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// 加载私有CA
+	if profile.CAFile != "" {
+		caPEM, err := os.ReadFile(profile.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", profile.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// parseTLSVersion 解析TLS版本字符串
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version %q", version)
+	}
+}
+
+// WatchProfiles 定期检查配置档的证书文件，发生变化时重新加载
+// 重新加载失败时保留原有传输层继续使用；interval不大于0时不检查
+func (c *Client) WatchProfiles(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		c.logger.Info("Certificate reload disabled (interval %v)", interval)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.mu.RLock()
+			profiles := make(map[string]*profileTransport, len(c.profiles))
+			for name, pt := range c.profiles {
+				profiles[name] = pt
+			}
+			c.mu.RUnlock()
+
+			for name, pt := range profiles {
+				if !pt.changed() {
+					continue
+				}
+				if err := pt.reload(); err != nil {
+					c.logger.Error("Failed to reload TLS profile %s: %v", name, err)
+					continue
+				}
+				c.logger.Info("TLS profile %s reloaded", name)
+			}
+		}
+	}
+}
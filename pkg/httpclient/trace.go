@@ -0,0 +1,129 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing 单次请求各阶段耗时，跟随重定向时为最后一跳的数据
+type Timing struct {
+	// DNS 域名解析耗时，复用连接或目标为IP时为0
+	DNS time.Duration
+	// Connect 建立TCP连接耗时
+	Connect time.Duration
+	// TLSHandshake TLS握手耗时
+	TLSHandshake time.Duration
+	// TimeToFirstByte 请求写出后到收到响应首字节的耗时（接收方处理时间）
+	TimeToFirstByte time.Duration
+	// Transfer 收到首字节后读取完响应的耗时
+	Transfer time.Duration
+	// ConnReused 是否复用了空闲连接
+	ConnReused bool
+	// Connected 是否取得了连接（新建或复用），连接前失败时为false
+	Connected bool
+	// RemoteIP 实际连接的对端IP
+	RemoteIP string
+}
+
+// timingTracer 通过httptrace收集请求各阶段耗时
+// 回调可能在拨号协程中执行，所有字段由mu保护
+type timingTracer struct {
+	mu     sync.Mutex
+	timing Timing
+
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	firstByte    time.Time
+}
+
+// clientTrace 返回收集耗时的httptrace回调
+func (t *timingTracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GetConn: func(string) {
+			// 每一跳重新开始计时
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timing = Timing{}
+			t.dnsStart, t.connectStart, t.tlsStart = time.Time{}, time.Time{}, time.Time{}
+			t.wroteRequest, t.firstByte = time.Time{}, time.Time{}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timing.ConnReused = info.Reused
+			t.timing.Connected = true
+			if info.Conn != nil {
+				if host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String()); err == nil {
+					t.timing.RemoteIP = host
+				}
+			}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.dnsStart = time.Now()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if !t.dnsStart.IsZero() {
+				t.timing.DNS = time.Since(t.dnsStart)
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			// 多地址并发拨号时从第一次拨号开始计时
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if err == nil && t.timing.Connect == 0 {
+				t.timing.Connect = time.Since(t.connectStart)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if !t.tlsStart.IsZero() {
+				t.timing.TLSHandshake = time.Since(t.tlsStart)
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.firstByte = time.Now()
+			if !t.wroteRequest.IsZero() {
+				t.timing.TimeToFirstByte = t.firstByte.Sub(t.wroteRequest)
+			}
+		},
+	}
+}
+
+// finish 响应体读取完成后计算传输耗时并返回结果
+func (t *timingTracer) finish() Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.firstByte.IsZero() {
+		t.timing.Transfer = time.Since(t.firstByte)
+	}
+	return t.timing
+}
@@ -0,0 +1,71 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SchemeHTTPUnix 通过Unix域套接字发送HTTP请求的URL协议
+// URL格式：http+unix:///var/run/app.sock:/hooks/order?a=1，第一个冒号之前为套接字路径，之后为请求路径
+const SchemeHTTPUnix = "http+unix"
+
+// ParseUnixURL 解析http+unix URL，返回套接字路径和等价的http请求URL
+func ParseUnixURL(raw string) (string, string, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", "", err
+	}
+	if parsed.Scheme != SchemeHTTPUnix {
+		return "", "", fmt.Errorf("not a %s URL", SchemeHTTPUnix)
+	}
+	if parsed.Host != "" {
+		return "", "", fmt.Errorf("%s URL must not have a host, use %s:///path/to.sock:/request-path", SchemeHTTPUnix, SchemeHTTPUnix)
+	}
+
+	socketPath, requestPath, _ := strings.Cut(parsed.Path, ":")
+	if socketPath == "" || !strings.HasPrefix(socketPath, "/") {
+		return "", "", fmt.Errorf("%s URL must contain an absolute socket path", SchemeHTTPUnix)
+	}
+	if requestPath == "" {
+		requestPath = "/"
+	}
+
+	requestURL := &url.URL{
+		Scheme:   "http",
+		Host:     "localhost",
+		Path:     requestPath,
+		RawQuery: parsed.RawQuery,
+	}
+	return socketPath, requestURL.String(), nil
+}
+
+// newUnixTransport 创建连接指定Unix域套接字的传输层
+// 每个套接字使用独立的传输层，避免不同套接字的连接在连接池中混用
+func newUnixTransport(socketPath string) *http.Transport {
+	dialer := &net.Dialer{KeepAlive: 30 * time.Second}
+	return &http.Transport{
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 2,
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+}
+
+// unixTransportFor 获取套接字对应的传输层
+func (c *Client) unixTransportFor(socketPath string) *http.Transport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	transport, ok := c.unixTransports[socketPath]
+	if !ok {
+		transport = newUnixTransport(socketPath)
+		c.unixTransports[socketPath] = transport
+	}
+	return transport
+}